@@ -113,6 +113,37 @@ describe('DaemonClient', () => {
     expect(running).toBe(false);
   });
 
+  it('should deliver notifications before the streamed response', async () => {
+    await new Promise<void>((resolve) => {
+      server = createServer((conn) => {
+        let data = '';
+        conn.on('data', (chunk) => {
+          data += chunk.toString();
+          if (data.includes('\n')) {
+            const req = JSON.parse(data.trim());
+            for (const delta of ['Hello', ', world']) {
+              conn.write(JSON.stringify({ jsonrpc: '2.0', method: 'stream.delta', params: { delta } }) + '\n');
+            }
+            conn.write(JSON.stringify({ jsonrpc: '2.0', result: { summary: 'Hello, world' }, id: req.id }) + '\n');
+          }
+        });
+      });
+      server.listen(TEST_SOCKET, () => resolve());
+    });
+
+    const deltas: string[] = [];
+    const result = await client.stream<{ summary: string }>(
+      'clipboard.summarize',
+      { content: 'text', stream: true },
+      (method, params) => {
+        if (method === 'stream.delta') deltas.push((params as { delta: string }).delta);
+      },
+    );
+
+    expect(deltas).toEqual(['Hello', ', world']);
+    expect(result.summary).toBe('Hello, world');
+  });
+
   it('should increment request IDs', async () => {
     const ids: number[] = [];
     await startMockServer(() => {
@@ -0,0 +1,59 @@
+import chalk from 'chalk';
+import ora from 'ora';
+import { client, PauseState } from '../lib/client.js';
+
+interface PauseOptions {
+  for?: string;
+}
+
+function describe(state: PauseState): string {
+  if (!state.paused) {
+    return `${state.name} is running`;
+  }
+  if (state.until) {
+    return `${state.name} paused until ${new Date(state.until).toLocaleString()}`;
+  }
+  return `${state.name} paused until resumed`;
+}
+
+export async function pause(trigger: string | undefined, options: PauseOptions): Promise<void> {
+  const spinner = ora('Pausing...').start();
+
+  try {
+    const minutes = options.for ? parseInt(options.for, 10) : undefined;
+    if (minutes !== undefined && (isNaN(minutes) || minutes <= 0)) {
+      spinner.fail('--for must be a positive number of minutes');
+      return;
+    }
+    const state = trigger
+      ? await client.call<PauseState>('trigger.pause', { name: trigger, minutes })
+      : await client.call<PauseState>('queue.pause', { minutes });
+    spinner.succeed(describe(state));
+  } catch (err) {
+    spinner.fail(`Failed to pause: ${err}`);
+  }
+}
+
+export async function resume(trigger: string | undefined): Promise<void> {
+  const spinner = ora('Resuming...').start();
+
+  try {
+    const state = trigger
+      ? await client.call<PauseState>('trigger.resume', { name: trigger })
+      : await client.call<PauseState>('queue.resume', {});
+    spinner.succeed(describe(state));
+  } catch (err) {
+    spinner.fail(`Failed to resume: ${err}`);
+  }
+}
+
+export async function paused(): Promise<void> {
+  try {
+    const states = await client.call<PauseState[]>('trigger.list', {});
+    for (const s of states) {
+      console.log(s.paused ? chalk.yellow(describe(s)) : chalk.gray(describe(s)));
+    }
+  } catch (err) {
+    console.error(chalk.red(`Failed to fetch pause state: ${err}`));
+  }
+}
@@ -21,14 +21,35 @@ export async function summarize(text?: string): Promise<void> {
       return;
     }
 
-    const result = await client.call<SummarizeResult>('clipboard.summarize', {
-      content: text,
-    });
+    let streaming = false;
+    const result = await client.stream<SummarizeResult>(
+      'clipboard.summarize',
+      { content: text, stream: true },
+      (method, params) => {
+        if (method === 'stream.reset') {
+          // The daemon is retrying; what was printed so far is incomplete
+          if (streaming) process.stdout.write(chalk.dim('\n[retrying]\n'));
+          return;
+        }
+        if (method !== 'stream.delta') return;
+        if (!streaming) {
+          streaming = true;
+          spinner.stop();
+          console.log(chalk.bold('Summary:'));
+          console.log('─'.repeat(40));
+        }
+        process.stdout.write((params as { delta: string }).delta);
+      },
+    );
 
-    spinner.stop();
-    console.log(chalk.bold('Summary:'));
-    console.log('─'.repeat(40));
-    console.log(result.summary);
+    if (streaming) {
+      process.stdout.write('\n');
+    } else {
+      spinner.stop();
+      console.log(chalk.bold('Summary:'));
+      console.log('─'.repeat(40));
+      console.log(result.summary);
+    }
     console.log('─'.repeat(40));
   } catch (err) {
     spinner.fail(`Failed to summarize: ${err}`);
@@ -1,10 +1,12 @@
 import chalk from 'chalk';
 import ora from 'ora';
-import { client, Task } from '../lib/client.js';
+import { client, TaskPage } from '../lib/client.js';
 
 interface TasksOptions {
   limit?: string;
   status?: string;
+  type?: string;
+  search?: string;
 }
 
 function statusColor(status: string): string {
@@ -13,6 +15,7 @@ function statusColor(status: string): string {
     case 'running':   return chalk.yellow(status);
     case 'failed':    return chalk.red(status);
     case 'pending':   return chalk.gray(status);
+    case 'cancelled': return chalk.magenta(status);
     default:          return status;
   }
 }
@@ -31,11 +34,14 @@ export async function tasks(options: TasksOptions): Promise<void> {
 
   try {
     const limit = options.limit ? parseInt(options.limit, 10) : 20;
-    let result = await client.call<Task[]>('task.history', { limit });
-
-    if (options.status) {
-      result = result.filter(t => t.status === options.status);
-    }
+    const page = await client.call<TaskPage>('task.query', {
+      limit,
+      statuses: options.status ? options.status.split(',') : undefined,
+      types: options.type ? options.type.split(',') : undefined,
+      search: options.search,
+      fields: ['type', 'status', 'created_at', 'error', 'retry_count', 'next_attempt_at', 'progress'],
+    });
+    const result = page.tasks;
 
     spinner.stop();
 
@@ -63,6 +69,13 @@ export async function tasks(options: TasksOptions): Promise<void> {
         statusColor(t.status).padEnd(cols.status + 10) + // extra for ANSI codes
         chalk.gray(formatTime(t.created_at))
       );
+      if (t.status === 'running' && t.progress) {
+        const p = t.progress;
+        console.log(chalk.gray(`  ${p.step ?? ''} ${p.percent}%${p.message ? `: ${p.message}` : ''}`));
+      }
+      if (t.status === 'pending' && t.next_attempt_at) {
+        console.log(chalk.gray(`  retry ${t.retry_count ?? 0} at ${formatTime(t.next_attempt_at)}: ${t.error ?? ''}`));
+      }
     }
 
     console.log(chalk.gray(`\n${result.length} task${result.length !== 1 ? 's' : ''}`));
@@ -0,0 +1,65 @@
+import chalk from 'chalk';
+import ora from 'ora';
+import { client, UsageReport } from '../lib/client.js';
+
+interface UsageOptions {
+  since?: string;
+  until?: string;
+  provider?: string;
+  type?: string;
+}
+
+function formatCost(usd: number): string {
+  return `$${usd.toFixed(4)}`;
+}
+
+export async function usage(options: UsageOptions): Promise<void> {
+  const spinner = ora('Fetching usage...').start();
+
+  try {
+    const report = await client.call<UsageReport>('usage.report', {
+      since: options.since,
+      until: options.until,
+      provider: options.provider,
+      task_type: options.type,
+    });
+
+    spinner.stop();
+
+    const rows = report.rows ?? [];
+    if (rows.length === 0) {
+      console.log(chalk.gray('No usage recorded'));
+      return;
+    }
+
+    // Header
+    const cols = { day: 12, provider: 12, type: 22, calls: 8, tokens: 12 };
+    console.log(
+      chalk.bold(
+        'Day'.padEnd(cols.day) +
+        'Provider'.padEnd(cols.provider) +
+        'Task type'.padEnd(cols.type) +
+        'Calls'.padEnd(cols.calls) +
+        'Tokens'.padEnd(cols.tokens) +
+        'Cost'
+      )
+    );
+    console.log('─'.repeat(cols.day + cols.provider + cols.type + cols.calls + cols.tokens + 10));
+
+    for (const r of rows) {
+      console.log(
+        chalk.gray(r.day.padEnd(cols.day)) +
+        chalk.cyan(r.provider.padEnd(cols.provider)) +
+        (r.task_type || '-').padEnd(cols.type) +
+        String(r.calls).padEnd(cols.calls) +
+        String(r.total_tokens).padEnd(cols.tokens) +
+        formatCost(r.cost_usd)
+      );
+    }
+
+    const t = report.total;
+    console.log(chalk.bold(`\n${t.calls} calls, ${t.total_tokens} tokens, ${formatCost(t.cost_usd)}`));
+  } catch (err) {
+    spinner.fail(`Failed to fetch usage: ${err}`);
+  }
+}
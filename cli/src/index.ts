@@ -113,12 +113,53 @@ program
   .command('tasks')
   .description('View task queue history')
   .option('-l, --limit <n>', 'number of tasks to show', '20')
-  .option('-s, --status <status>', 'filter by status (pending, running, completed, failed)')
+  .option('-s, --status <status>', 'filter by status, comma-separated (pending, running, completed, failed, cancelled)')
+  .option('-t, --type <type>', 'filter by task type, comma-separated')
+  .option('-q, --search <text>', 'search task payloads and errors')
   .action(async (options) => {
     const { tasks } = await import('./commands/tasks.js');
     await tasks(options);
   });
 
+program
+  .command('pause')
+  .description('Pause the task queue, or one trigger (clipboard, auto_file, screenshots)')
+  .argument('[trigger]', 'trigger to pause instead of the queue')
+  .option('--for <minutes>', 'resume automatically after this many minutes')
+  .action(async (trigger, options) => {
+    const { pause } = await import('./commands/pause.js');
+    await pause(trigger, options);
+  });
+
+program
+  .command('resume')
+  .description('Resume the task queue, or one trigger')
+  .argument('[trigger]', 'trigger to resume instead of the queue')
+  .action(async (trigger) => {
+    const { resume } = await import('./commands/pause.js');
+    await resume(trigger);
+  });
+
+program
+  .command('paused')
+  .description('Show which of the queue and triggers are paused')
+  .action(async () => {
+    const { paused } = await import('./commands/pause.js');
+    await paused();
+  });
+
+program
+  .command('usage')
+  .description('Show LLM token usage and cost')
+  .option('--since <date>', 'first day to include (YYYY-MM-DD), defaults to 30 days ago')
+  .option('--until <date>', 'last day to include (YYYY-MM-DD)')
+  .option('-p, --provider <name>', 'only show one provider')
+  .option('-t, --type <task-type>', 'only show one task type')
+  .action(async (options) => {
+    const { usage } = await import('./commands/usage.js');
+    await usage(options);
+  });
+
 // Pipelines
 const pipeline = program.command('pipeline').description('Manage automation pipelines');
 
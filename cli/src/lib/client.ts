@@ -9,6 +9,12 @@ interface JsonRpcRequest {
   id: number;
 }
 
+interface JsonRpcNotification {
+  jsonrpc: '2.0';
+  method: string;
+  params?: unknown;
+}
+
 interface JsonRpcResponse {
   jsonrpc: '2.0';
   result?: unknown;
@@ -80,6 +86,92 @@ export class DaemonClient {
     });
   }
 
+  /**
+   * Like call(), but also delivers JSON-RPC notifications sent by the daemon
+   * before the final response (e.g. stream.delta chunks).
+   */
+  async stream<T>(
+    method: string,
+    params: unknown,
+    onNotification: (method: string, params: unknown) => void,
+  ): Promise<T> {
+    return new Promise((resolve, reject) => {
+      const socket = createConnection(this.socketPath);
+      let buffer = '';
+      let settled = false;
+
+      const settle = (fn: () => void) => {
+        if (settled) return;
+        settled = true;
+        socket.end();
+        fn();
+      };
+
+      socket.on('connect', () => {
+        const request: JsonRpcRequest = {
+          jsonrpc: '2.0',
+          method,
+          params,
+          id: ++this.requestId,
+        };
+        socket.write(JSON.stringify(request) + '\n');
+      });
+
+      socket.on('data', (chunk) => {
+        buffer += chunk.toString();
+        let newline: number;
+        while ((newline = buffer.indexOf('\n')) >= 0) {
+          const line = buffer.slice(0, newline).trim();
+          buffer = buffer.slice(newline + 1);
+          if (!line) continue;
+
+          let message: JsonRpcResponse | JsonRpcNotification;
+          try {
+            message = JSON.parse(line);
+          } catch {
+            settle(() => reject(new Error(`Failed to parse response: ${line}`)));
+            return;
+          }
+
+          if (!('id' in message)) {
+            onNotification(message.method, message.params);
+            continue;
+          }
+
+          const response = message;
+          settle(() => {
+            if (response.error) {
+              reject(new Error(response.error.message));
+            } else {
+              resolve(response.result as T);
+            }
+          });
+          return;
+        }
+      });
+
+      socket.on('end', () => {
+        settle(() => reject(new Error('Connection closed before response')));
+      });
+
+      socket.on('error', (err) => {
+        if ((err as NodeJS.ErrnoException).code === 'ENOENT') {
+          settle(() => reject(new Error('Daemon is not running. Start it with: bender start')));
+        } else if ((err as NodeJS.ErrnoException).code === 'ECONNREFUSED') {
+          settle(() => reject(new Error('Cannot connect to daemon. Is it running?')));
+        } else {
+          settle(() => reject(err));
+        }
+      });
+
+      // Streams can run long; only time out when the daemon goes quiet
+      socket.setTimeout(30000, () => {
+        socket.destroy();
+        settle(() => reject(new Error('Request timed out')));
+      });
+    });
+  }
+
   async isRunning(): Promise<boolean> {
     try {
       await this.call('status.get');
@@ -97,11 +189,13 @@ export interface DaemonStatus {
   started_at: string;
   pid: number;
   go_version: string;
+  stats?: Record<string, unknown>;
 }
 
 export interface HealthCheck {
   status: string;
   checks: Record<string, string>;
+  details?: Record<string, unknown>;
   timestamp: string;
 }
 
@@ -113,6 +207,46 @@ export interface Task {
   created_at: string;
   started_at?: string;
   finished_at?: string;
+  error?: string;
+  retry_count?: number;
+  next_attempt_at?: string;
+  job_id?: string;
+  depends_on?: string[];
+  progress?: TaskProgress;
+}
+
+export interface TaskProgress {
+  step?: string;
+  percent: number;
+  message?: string;
+  updated_at: string;
+}
+
+export interface TaskPage {
+  tasks: Task[];
+  next_cursor?: string;
+}
+
+export interface PauseState {
+  name: string;
+  paused: boolean;
+  until?: string;
+}
+
+export interface UsageRow {
+  day: string;
+  provider: string;
+  task_type: string;
+  calls: number;
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+  cost_usd: number;
+}
+
+export interface UsageReport {
+  rows: UsageRow[] | null;
+  total: UsageRow;
 }
 
 export const client = new DaemonClient();
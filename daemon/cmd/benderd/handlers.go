@@ -11,34 +11,48 @@ import (
 	"github.com/user/bender/internal/config"
 	"github.com/user/bender/internal/llm"
 	"github.com/user/bender/internal/logging"
+	"github.com/user/bender/internal/task"
 )
 
+// permanentIfMissing marks file-not-found errors as permanent so the queue
+// does not retry a task whose input is gone
+func permanentIfMissing(err error) error {
+	if os.IsNotExist(err) {
+		return task.Permanent(err)
+	}
+	return err
+}
+
 // Ensure handler signatures match json.RawMessage types
 // json.RawMessage is []byte but Go requires the exact type match
 
 // Clipboard summarization
 
 type summarizePayload struct {
-	Content string `json:"content"`
+	Content  string `json:"content"`
+	StreamID string `json:"stream_id,omitempty"`
+	NoCache  bool   `json:"no_cache,omitempty"`
 }
 
 type summarizeResult struct {
 	Summary string `json:"summary"`
 }
 
-func handleClipboardSummarize(ctx context.Context, payload []byte, router *llm.Router) ([]byte, error) {
+func handleClipboardSummarize(ctx context.Context, payload []byte, router *llm.Router, streams *streamRegistry) ([]byte, error) {
 	var p summarizePayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 
 	if p.Content == "" {
-		return nil, fmt.Errorf("empty content")
+		return nil, task.Permanent(fmt.Errorf("empty content"))
 	}
 
 	logging.Info("summarizing clipboard content (%d chars)", len(p.Content))
 
-	resp, err := router.Complete(ctx, llm.CompletionRequest{
+	resp, err := streams.complete(ctx, router, p.StreamID, llm.CompletionRequest{
+		Route:   string(task.TaskClipboardSummarize),
+		NoCache: p.NoCache,
 		Messages: []llm.Message{
 			{Role: "system", Content: "You are a concise summarizer. Summarize the following text in 2-3 sentences. Focus on the key points and main ideas. Return only the summary, nothing else."},
 			{Role: "user", Content: p.Content},
@@ -58,7 +72,8 @@ func handleClipboardSummarize(ctx context.Context, payload []byte, router *llm.R
 // File classification
 
 type classifyPayload struct {
-	Path string `json:"path"`
+	Path    string `json:"path"`
+	NoCache bool   `json:"no_cache,omitempty"`
 }
 
 type classifyResult struct {
@@ -67,19 +82,25 @@ type classifyResult struct {
 	Confidence  string `json:"confidence"`
 }
 
+// classifyAnswer is the structured answer requested from the LLM
+type classifyAnswer struct {
+	Category   string `json:"category"`
+	Confidence string `json:"confidence"`
+}
+
 func handleFileClassify(ctx context.Context, payload []byte, router *llm.Router, cfg *config.Config) ([]byte, error) {
 	var p classifyPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 
 	if p.Path == "" {
-		return nil, fmt.Errorf("empty path")
+		return nil, task.Permanent(fmt.Errorf("empty path"))
 	}
 
 	info, err := os.Stat(p.Path)
 	if err != nil {
-		return nil, fmt.Errorf("stat file: %w", err)
+		return nil, fmt.Errorf("stat file: %w", permanentIfMissing(err))
 	}
 
 	ext := strings.TrimPrefix(filepath.Ext(p.Path), ".")
@@ -123,7 +144,9 @@ func handleFileClassify(ctx context.Context, payload []byte, router *llm.Router,
 	}
 
 	var catDescs []string
+	catNames := []string{"unknown"}
 	for _, cat := range cfg.AutoFile.Categories {
+		catNames = append(catNames, cat.Name)
 		desc := cat.Name
 		if cat.Description != "" {
 			desc += ": " + cat.Description
@@ -143,31 +166,44 @@ Content preview: %s
 Available categories:
 %s
 
-Return ONLY the category name, nothing else.`, name, ext, size, preview, strings.Join(catDescs, "\n"))
+Respond with JSON: {"category": "<category name>", "confidence": "high" | "medium" | "low"}.
+Use "unknown" if no category fits.`, name, ext, size, preview, strings.Join(catDescs, "\n"))
 
 	logging.Info("classifying file %s via LLM", name)
 
 	resp, err := router.Complete(ctx, llm.CompletionRequest{
+		Route:   string(task.TaskFileClassify),
+		NoCache: p.NoCache,
 		Messages: []llm.Message{
-			{Role: "system", Content: "You are a file classification assistant. Return only the exact category name from the provided list."},
+			{Role: "system", Content: "You are a file classification assistant. Pick the exact category name from the provided list."},
 			{Role: "user", Content: prompt},
 		},
 		Temperature: 0.1,
-		MaxTokens:   32,
+		MaxTokens:   64,
+		ResponseSchema: jsonSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"category":   map[string]any{"type": "string", "enum": catNames},
+				"confidence": map[string]any{"type": "string", "enum": []string{"high", "medium", "low"}},
+			},
+			"required": []string{"category", "confidence"},
+		}),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("llm completion: %w", err)
 	}
 
-	category := strings.TrimSpace(strings.ToLower(resp.Content))
+	var answer classifyAnswer
+	if err := json.Unmarshal([]byte(resp.Content), &answer); err != nil {
+		return nil, fmt.Errorf("parse classification: %w", err)
+	}
+	category, confidence := answer.Category, answer.Confidence
 
 	// Find the matching category for the destination path
 	dest := filepath.Join(cfg.AutoFile.DestinationRoot, name)
-	confidence := "medium"
 	for _, cat := range cfg.AutoFile.Categories {
-		if strings.EqualFold(cat.Name, category) {
+		if cat.Name == category {
 			dest = filepath.Join(cat.Path, name)
-			confidence = "high"
 			break
 		}
 	}
@@ -184,7 +220,8 @@ Return ONLY the category name, nothing else.`, name, ext, size, preview, strings
 // File rename
 
 type renamePayload struct {
-	Path string `json:"path"`
+	Path    string `json:"path"`
+	NoCache bool   `json:"no_cache,omitempty"`
 }
 
 type renameResult struct {
@@ -193,19 +230,25 @@ type renameResult struct {
 	Reason       string `json:"reason"`
 }
 
+// renameAnswer is the structured answer requested from the LLM
+type renameAnswer struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
 func handleFileRename(ctx context.Context, payload []byte, router *llm.Router, cfg *config.Config) ([]byte, error) {
 	var p renamePayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 
 	if p.Path == "" {
-		return nil, fmt.Errorf("empty path")
+		return nil, task.Permanent(fmt.Errorf("empty path"))
 	}
 
 	info, err := os.Stat(p.Path)
 	if err != nil {
-		return nil, fmt.Errorf("stat file: %w", err)
+		return nil, fmt.Errorf("stat file: %w", permanentIfMissing(err))
 	}
 
 	originalName := filepath.Base(p.Path)
@@ -240,27 +283,36 @@ Content preview: %s
 
 Use %s naming convention.
 Keep under %d characters.
-Return ONLY the new filename without the extension, nothing else.`,
+Respond with JSON: {"name": "<new filename without the extension>", "reason": "<short reason>"}.`,
 		fileType, nameWithoutExt, size, preview,
 		cfg.Rename.NamingConvention, cfg.Rename.MaxLength)
 
 	logging.Info("generating rename for %s via LLM", originalName)
 
 	resp, err := router.Complete(ctx, llm.CompletionRequest{
+		Route:   string(task.TaskFileRename),
+		NoCache: p.NoCache,
 		Messages: []llm.Message{
-			{Role: "system", Content: "You are a file naming assistant. Generate descriptive, clean filenames. Return only the filename without extension."},
+			{Role: "system", Content: "You are a file naming assistant. Generate descriptive, clean filenames without the extension."},
 			{Role: "user", Content: prompt},
 		},
-		Temperature: 0.3,
-		MaxTokens:   64,
+		Temperature:    0.3,
+		MaxTokens:      128,
+		ResponseSchema: renameSchema(cfg.Rename.MaxLength),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("llm completion: %w", err)
 	}
 
-	newName := strings.TrimSpace(resp.Content)
-	// Remove any quotes the LLM might add
-	newName = strings.Trim(newName, "\"'`")
+	var answer renameAnswer
+	if err := json.Unmarshal([]byte(resp.Content), &answer); err != nil {
+		return nil, fmt.Errorf("parse rename: %w", err)
+	}
+	newName := strings.TrimSuffix(answer.Name, ext)
+	reason := answer.Reason
+	if reason == "" {
+		reason = "LLM-generated descriptive name"
+	}
 
 	if cfg.Rename.IncludeDate {
 		dateStr := info.ModTime().Format("2006-01-02")
@@ -280,15 +332,34 @@ Return ONLY the new filename without the extension, nothing else.`,
 	return json.Marshal(renameResult{
 		OriginalName: originalName,
 		NewName:      newName,
-		Reason:       "LLM-generated descriptive name",
+		Reason:       reason,
+	})
+}
+
+// renameSchema describes the rename answer, capping the name length when
+// the config sets one
+func renameSchema(maxLength int) json.RawMessage {
+	nameSchema := map[string]any{"type": "string", "minLength": 1}
+	if maxLength > 0 {
+		nameSchema["maxLength"] = maxLength
+	}
+	return jsonSchema(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":   nameSchema,
+			"reason": map[string]any{"type": "string"},
+		},
+		"required": []string{"name", "reason"},
 	})
 }
 
 // Git commit message generation
 
 type commitPayload struct {
-	Diff  string   `json:"diff"`
-	Files []string `json:"files"`
+	Diff     string   `json:"diff"`
+	Files    []string `json:"files"`
+	StreamID string   `json:"stream_id,omitempty"`
+	NoCache  bool     `json:"no_cache,omitempty"`
 }
 
 type commitResult struct {
@@ -297,14 +368,14 @@ type commitResult struct {
 	Body    string `json:"body"`
 }
 
-func handleGitCommit(ctx context.Context, payload []byte, router *llm.Router, cfg *config.Config) ([]byte, error) {
+func handleGitCommit(ctx context.Context, payload []byte, router *llm.Router, cfg *config.Config, streams *streamRegistry) ([]byte, error) {
 	var p commitPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 
 	if p.Diff == "" && len(p.Files) == 0 {
-		return nil, fmt.Errorf("no diff or files provided")
+		return nil, task.Permanent(fmt.Errorf("no diff or files provided"))
 	}
 
 	diff := p.Diff
@@ -342,7 +413,9 @@ Diff:
 
 	logging.Info("generating commit message for %d files via LLM", len(p.Files))
 
-	resp, err := router.Complete(ctx, llm.CompletionRequest{
+	resp, err := streams.complete(ctx, router, p.StreamID, llm.CompletionRequest{
+		Route:   string(task.TaskGitCommit),
+		NoCache: p.NoCache,
 		Messages: []llm.Message{
 			{Role: "system", Content: "You are a git commit message generator. Write clear, accurate commit messages based on the diff provided. Return only the commit message, nothing else."},
 			{Role: "user", Content: prompt},
@@ -379,7 +452,8 @@ Diff:
 // Screenshot tagging
 
 type screenshotPayload struct {
-	Path string `json:"path"`
+	Path    string `json:"path"`
+	NoCache bool   `json:"no_cache,omitempty"`
 }
 
 type screenshotResult struct {
@@ -389,19 +463,29 @@ type screenshotResult struct {
 	SuggestedName string   `json:"suggested_name"`
 }
 
+var screenshotSchema = jsonSchema(map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"app":         map[string]any{"type": "string"},
+		"description": map[string]any{"type": "string", "maxLength": 100},
+		"tags":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "maxItems": 5},
+	},
+	"required": []string{"app", "description", "tags"},
+})
+
 func handleScreenshotTag(ctx context.Context, payload []byte, router *llm.Router, cfg *config.Config) ([]byte, error) {
 	var p screenshotPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 
 	if p.Path == "" {
-		return nil, fmt.Errorf("empty path")
+		return nil, task.Permanent(fmt.Errorf("empty path"))
 	}
 
 	imgData, err := os.ReadFile(p.Path)
 	if err != nil {
-		return nil, fmt.Errorf("read image: %w", err)
+		return nil, fmt.Errorf("read image: %w", permanentIfMissing(err))
 	}
 
 	ext := strings.ToLower(filepath.Ext(p.Path))
@@ -419,6 +503,8 @@ func handleScreenshotTag(ctx context.Context, payload []byte, router *llm.Router
 
 	resp, err := router.CompleteWithVision(ctx, llm.VisionRequest{
 		CompletionRequest: llm.CompletionRequest{
+			Route:   string(task.TaskScreenshotTag),
+			NoCache: p.NoCache,
 			Messages: []llm.Message{
 				{Role: "system", Content: "You are a screenshot analysis assistant."},
 				{Role: "user", Content: `Analyze this screenshot and provide:
@@ -426,10 +512,11 @@ func handleScreenshotTag(ctx context.Context, payload []byte, router *llm.Router
 2. Brief description of content (under 10 words)
 3. Up to 5 relevant tags
 
-Return as JSON: {"app": "", "description": "", "tags": []}`},
+Respond with JSON: {"app": "", "description": "", "tags": []}`},
 			},
-			Temperature: 0.2,
-			MaxTokens:   256,
+			Temperature:    0.2,
+			MaxTokens:      256,
+			ResponseSchema: screenshotSchema,
 		},
 		Images: []llm.Image{
 			{Data: imgData, MimeType: mimeType},
@@ -439,22 +526,9 @@ Return as JSON: {"app": "", "description": "", "tags": []}`},
 		return nil, fmt.Errorf("vision completion: %w", err)
 	}
 
-	content := strings.TrimSpace(resp.Content)
-	// Try to extract JSON from the response
-	if idx := strings.Index(content, "{"); idx >= 0 {
-		if end := strings.LastIndex(content, "}"); end > idx {
-			content = content[idx : end+1]
-		}
-	}
-
 	var result screenshotResult
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		// If JSON parsing fails, use the raw response
-		result = screenshotResult{
-			App:         "unknown",
-			Description: content,
-			Tags:        []string{},
-		}
+	if err := json.Unmarshal([]byte(resp.Content), &result); err != nil {
+		return nil, fmt.Errorf("parse tags: %w", err)
 	}
 
 	// Generate suggested filename
@@ -476,6 +550,15 @@ Return as JSON: {"app": "", "description": "", "tags": []}`},
 	return json.Marshal(result)
 }
 
+// jsonSchema encodes a JSON schema built from Go values
+func jsonSchema(schema map[string]any) json.RawMessage {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		panic(fmt.Sprintf("invalid JSON schema: %v", err))
+	}
+	return data
+}
+
 func sanitizeFilename(s string) string {
 	s = strings.ToLower(s)
 	s = strings.Map(func(r rune) rune {
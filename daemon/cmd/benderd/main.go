@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/user/bender/internal/api"
+	"github.com/user/bender/internal/cache"
 	"github.com/user/bender/internal/clipboard"
 	"github.com/user/bender/internal/config"
 	"github.com/user/bender/internal/fileops"
@@ -20,7 +24,10 @@ import (
 	"github.com/user/bender/internal/llm"
 	"github.com/user/bender/internal/logging"
 	"github.com/user/bender/internal/notify"
+	"github.com/user/bender/internal/pause"
+	"github.com/user/bender/internal/schedule"
 	"github.com/user/bender/internal/task"
+	"github.com/user/bender/internal/usage"
 )
 
 var (
@@ -90,6 +97,7 @@ func run(ctx context.Context, cfg *config.Config) error {
 		return fmt.Errorf("init llm router: %w", err)
 	}
 	logging.Info("LLM router initialized with provider: %s", router.DefaultProviderName())
+	router.StartHealthChecks(ctx, time.Duration(cfg.LLM.Health.IntervalSeconds)*time.Second)
 
 	// Initialize task queue
 	homeDir, _ := os.UserHomeDir()
@@ -99,11 +107,20 @@ func run(ctx context.Context, cfg *config.Config) error {
 	}
 
 	queue, err := task.NewQueue(task.Config{
-		DBPath:       dbPath,
-		MaxWorkers:   cfg.Queue.MaxConcurrent,
-		MaxRetries:   cfg.Queue.MaxRetries,
-		RetryDelay:   time.Duration(cfg.Queue.RetryDelaySeconds) * time.Second,
-		TaskTimeout:  time.Duration(cfg.Queue.DefaultTimeoutSeconds) * time.Second,
+		DBPath:          dbPath,
+		MaxWorkers:      cfg.Queue.MaxConcurrent,
+		MaxRetries:      cfg.Queue.MaxRetries,
+		RetryDelay:      time.Duration(cfg.Queue.RetryDelaySeconds) * time.Second,
+		MaxDelay:        time.Duration(cfg.Queue.MaxRetryDelaySeconds) * time.Second,
+		TaskTimeout:     time.Duration(cfg.Queue.DefaultTimeoutSeconds) * time.Second,
+		ReservedWorkers: *cfg.Queue.InteractiveWorkers,
+		Aging:           queueAging(*cfg.Queue.AgingSeconds),
+		MaxPending:      cfg.Queue.MaxPending,
+		DedupeWindow:    time.Duration(*cfg.Queue.DedupeWindowSeconds) * time.Second,
+		Types:           taskTypes(cfg.Queue.Types),
+		Retention:       taskRetention(cfg.Queue.Retention),
+		PruneInterval:   time.Duration(cfg.Queue.Retention.IntervalMinutes) * time.Minute,
+		DrainTimeout:    time.Duration(*cfg.Queue.DrainTimeoutSeconds) * time.Second,
 	})
 	if err != nil {
 		return fmt.Errorf("init task queue: %w", err)
@@ -115,6 +132,54 @@ func run(ctx context.Context, cfg *config.Config) error {
 		return fmt.Errorf("init undo manager: %w", err)
 	}
 	defer undoMgr.Close()
+	queue.OnPrune(func(task.PruneResult) {
+		if err := undoMgr.Cleanup(); err != nil {
+			logging.Warn("undo cleanup failed: %v", err)
+		}
+	})
+
+	// Initialize usage tracker
+	tracker, err := usage.NewTracker(dbPath, usagePrices(cfg.LLM.Pricing))
+	if err != nil {
+		return fmt.Errorf("init usage tracker: %w", err)
+	}
+	defer tracker.Close()
+	router.OnUsage(func(ctx context.Context, ev llm.UsageEvent) {
+		// Pipelines and job steps reuse the routes of the single-step
+		// handlers, so the route alone would misattribute their usage
+		taskType := string(task.TaskTypeFromContext(ctx))
+		if taskType == "" {
+			taskType = ev.Route
+		}
+		err := tracker.Record(usage.Record{
+			TaskID:           task.TaskIDFromContext(ctx),
+			TaskType:         taskType,
+			Provider:         ev.Provider,
+			Model:            ev.Model,
+			PromptTokens:     ev.Usage.PromptTokens,
+			CompletionTokens: ev.Usage.CompletionTokens,
+			TotalTokens:      ev.Usage.TotalTokens,
+		})
+		if err != nil {
+			logging.Warn("failed to record llm usage: %v", err)
+		}
+	})
+
+	// Initialize response cache
+	var respCache *cache.Store
+	if cfg.LLM.Cache.Enabled {
+		respCache, err = cache.NewStore(cache.Config{
+			DBPath:     dbPath,
+			TTL:        time.Duration(cfg.LLM.Cache.TTLHours) * time.Hour,
+			MaxEntries: cfg.LLM.Cache.MaxEntries,
+			MaxBytes:   int64(cfg.LLM.Cache.MaxSizeMB) << 20,
+		})
+		if err != nil {
+			return fmt.Errorf("init response cache: %w", err)
+		}
+		defer respCache.Close()
+		router.SetCache(respCache)
+	}
 
 	// Initialize notifier
 	notifier := notify.New(notify.Config{
@@ -123,21 +188,52 @@ func run(ctx context.Context, cfg *config.Config) error {
 		ShowPreviews: cfg.Notifications.ShowPreviews,
 	})
 
+	// Enforce provider budgets against recorded usage
+	router.SetSpendSource(func(provider string) (llm.Spend, error) {
+		s, err := tracker.Spend(provider, time.Now())
+		return llm.Spend(s), err
+	})
+	router.OnBudgetWarning(func(w llm.BudgetWarning) {
+		notifier.Send("Bender", budgetMessage(w, router.BudgetFallbacks(w.Provider)))
+	})
+
 	// Initialize pipeline runner
 	pipelines := NewPipelineRunner(router, cfg, undoMgr, notifier)
 
 	// Register task handlers
-	registerTaskHandlers(queue, router, cfg, pipelines)
+	streams := newStreamRegistry()
+	registerTaskHandlers(queue, router, cfg, pipelines, streams, undoMgr)
+
+	// Restore paused triggers and queue before anything starts acting
+	pauses, err := pause.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("init pause state: %w", err)
+	}
+	defer pauses.Close()
+	pauses.Register(pauseQueue, queue)
 
 	if err := queue.Start(); err != nil {
 		return fmt.Errorf("start task queue: %w", err)
 	}
 	defer queue.Stop()
 
+	// Initialize scheduler
+	scheduler, err := schedule.New(schedule.Config{DBPath: dbPath, Queue: queue})
+	if err != nil {
+		return fmt.Errorf("init scheduler: %w", err)
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
+
 	// Initialize API server
 	server := api.NewServer("")
-	api.RegisterStatusHandlers(server, version)
-	registerAPIHandlers(server, queue, router, cfg, undoMgr)
+	statusHandler := api.RegisterStatusHandlers(server, version)
+	registerHealthChecks(statusHandler, router)
+	if respCache != nil {
+		statusHandler.AddStats("llm_cache", func() any { return respCache.Stats() })
+	}
+	statusHandler.AddStats("pauses", func() any { return pauses.List() })
+	registerAPIHandlers(server, queue, router, cfg, undoMgr, streams, tracker, scheduler, pauses)
 
 	if err := server.Start(ctx); err != nil {
 		return fmt.Errorf("start api server: %w", err)
@@ -152,13 +248,14 @@ func run(ctx context.Context, cfg *config.Config) error {
 			DebounceMs: cfg.Clipboard.DebounceMs,
 			OnChange: func(content string) {
 				if cfg.Clipboard.AutoSummarize {
-					queue.Enqueue(task.TaskClipboardSummarize, []byte(`{"content":"`+escapeJSON(content)+`"}`), 0)
+					enqueueBackground(queue, task.TaskClipboardSummarize, []byte(`{"content":"`+escapeJSON(content)+`"}`), contentKey(content))
 					if cfg.Clipboard.Notification {
 						notifier.Send("Bender", "Summarizing clipboard content...")
 					}
 				}
 			},
 		})
+		pauses.Register(pauseClipboard, clipMonitor)
 		if err := clipMonitor.Start(); err != nil {
 			logging.Warn("failed to start clipboard monitor: %v", err)
 		} else {
@@ -182,12 +279,13 @@ func run(ctx context.Context, cfg *config.Config) error {
 					return
 				}
 				if cfg.AutoFile.AutoMove {
-					queue.Enqueue(task.TaskPipelineAutoFile, []byte(`{"path":"`+escapeJSON(event.Path)+`"}`), 0)
+					enqueueBackgroundJob(queue, autoFileSteps(event.Path), event.Path)
 				} else {
-					queue.Enqueue(task.TaskFileClassify, []byte(`{"path":"`+escapeJSON(event.Path)+`"}`), 0)
+					enqueueBackground(queue, task.TaskFileClassify, []byte(`{"path":"`+escapeJSON(event.Path)+`"}`), event.Path)
 				}
 			},
 		})
+		pauses.Register(pauseAutoFile, fileWatcher)
 		if err := fileWatcher.Start(); err != nil {
 			logging.Warn("failed to start file watcher: %v", err)
 		} else {
@@ -208,9 +306,10 @@ func run(ctx context.Context, cfg *config.Config) error {
 				if !isImageExtension(event.Path) {
 					return
 				}
-				queue.Enqueue(task.TaskPipelineScreenshot, []byte(`{"path":"`+escapeJSON(event.Path)+`"}`), 0)
+				enqueueBackground(queue, task.TaskPipelineScreenshot, []byte(`{"path":"`+escapeJSON(event.Path)+`"}`), event.Path)
 			},
 		})
+		pauses.Register(pauseScreenshots, screenshotWatcher)
 		if err := screenshotWatcher.Start(); err != nil {
 			logging.Warn("failed to start screenshot watcher: %v", err)
 		} else {
@@ -223,9 +322,31 @@ func run(ctx context.Context, cfg *config.Config) error {
 	return nil
 }
 
-func registerTaskHandlers(queue *task.Queue, router *llm.Router, cfg *config.Config, pipelines *PipelineRunner) {
+// registerHealthChecks reports each LLM provider's circuit breaker through
+// status.health.
+func registerHealthChecks(h *api.StatusHandler, router *llm.Router) {
+	for _, name := range router.ListProviders() {
+		h.AddCheck("llm."+name, func() (string, any) {
+			for _, ph := range router.Health() {
+				if ph.Name != name {
+					continue
+				}
+				switch ph.State {
+				case llm.BreakerOpen:
+					return "down", ph
+				case llm.BreakerHalfOpen:
+					return "degraded", ph
+				}
+				return "ok", ph
+			}
+			return "unknown", nil
+		})
+	}
+}
+
+func registerTaskHandlers(queue *task.Queue, router *llm.Router, cfg *config.Config, pipelines *PipelineRunner, streams *streamRegistry, undoMgr *fileops.UndoManager) {
 	queue.RegisterHandler(task.TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
-		return handleClipboardSummarize(ctx, payload, router)
+		return handleClipboardSummarize(ctx, payload, router, streams)
 	})
 
 	queue.RegisterHandler(task.TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
@@ -237,18 +358,105 @@ func registerTaskHandlers(queue *task.Queue, router *llm.Router, cfg *config.Con
 	})
 
 	queue.RegisterHandler(task.TaskGitCommit, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
-		return handleGitCommit(ctx, payload, router, cfg)
+		return handleGitCommit(ctx, payload, router, cfg, streams)
 	})
 
 	queue.RegisterHandler(task.TaskScreenshotTag, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
 		return handleScreenshotTag(ctx, payload, router, cfg)
 	})
 
-	queue.RegisterHandler(task.TaskPipelineAutoFile, pipelines.RunAutoFilePipeline)
+	queue.RegisterHandler(task.TaskAutoFileClassify, pipelines.ClassifyAutoFile)
+	queue.RegisterHandler(task.TaskAutoFileMove, pipelines.MoveAutoFile)
+	queue.RegisterHandler(task.TaskAutoFileRename, pipelines.RenameAutoFile)
+	queue.RegisterHandler(task.TaskAutoFileFinish, pipelines.FinishAutoFile)
+	queue.RegisterHandler(task.TaskPipelineAutoFile, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return handleAutoFileJob(ctx, payload, queue)
+	})
 	queue.RegisterHandler(task.TaskPipelineScreenshot, pipelines.RunScreenshotPipeline)
+
+	queue.RegisterHandler(task.TaskAutoFileSweep, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return handleAutoFileSweep(ctx, payload, queue, cfg)
+	})
+
+	queue.RegisterHandler(task.TaskUndoCleanup, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		if err := undoMgr.Cleanup(); err != nil {
+			return nil, fmt.Errorf("undo cleanup: %w", err)
+		}
+		return json.RawMessage(`{}`), nil
+	})
+}
+
+// budgetMessage describes a budget warning for a desktop notification.
+// fallbacks are the providers that take over once the budget is reached.
+func budgetMessage(w llm.BudgetWarning, fallbacks []string) string {
+	used, limit := fmt.Sprintf("%.0f", w.Used), fmt.Sprintf("%.0f", w.Limit)
+	if w.Unit == "usd" {
+		used, limit = fmt.Sprintf("$%.2f", w.Used), fmt.Sprintf("$%.2f", w.Limit)
+	} else {
+		used, limit = used+" tokens", limit+" tokens"
+	}
+	if w.Exceeded {
+		reached := fmt.Sprintf("%s %s budget reached (%s of %s).", w.Provider, w.Period, used, limit)
+		if len(fallbacks) == 0 {
+			return reached + " Requests to it will fail until the budget resets."
+		}
+		return fmt.Sprintf("%s Requests will use %s.", reached, strings.Join(fallbacks, ", "))
+	}
+	return fmt.Sprintf("%s at %.0f%% of its %s budget (%s of %s)", w.Provider, w.Percent, w.Period, used, limit)
+}
+
+// queueAging converts aging_seconds, where 0 turns aging off
+func queueAging(seconds int) time.Duration {
+	if seconds == 0 {
+		return -1
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// taskTypes converts the per-type queue settings
+func taskTypes(types map[string]config.QueueTypeConfig) map[task.TaskType]task.TypeConfig {
+	out := make(map[task.TaskType]task.TypeConfig, len(types))
+	for name, tc := range types {
+		out[task.TaskType(name)] = task.TypeConfig{
+			Timeout:    time.Duration(tc.TimeoutSeconds) * time.Second,
+			MaxRetries: tc.MaxRetries,
+			Workers:    tc.Workers,
+		}
+	}
+	return out
+}
+
+// taskRetention converts the configured retention policy for the queue
+func taskRetention(rc config.RetentionConfig) task.Retention {
+	r := task.Retention{
+		MaxAge:      days(rc.MaxAgeDays),
+		MaxRows:     rc.MaxRows,
+		ScrubAfter:  days(rc.ScrubAfterDays),
+		ArchivePath: rc.ArchivePath,
+	}
+	if len(rc.StatusMaxAgeDays) > 0 {
+		r.StatusMaxAge = make(map[task.TaskStatus]time.Duration, len(rc.StatusMaxAgeDays))
+		for status, n := range rc.StatusMaxAgeDays {
+			r.StatusMaxAge[task.TaskStatus(status)] = days(n)
+		}
+	}
+	return r
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// usagePrices converts the configured price table for the usage tracker
+func usagePrices(pricing map[string]config.PriceConfig) map[string]usage.Price {
+	prices := make(map[string]usage.Price, len(pricing))
+	for model, p := range pricing {
+		prices[model] = usage.Price{InputPerMTok: p.InputPerMTok, OutputPerMTok: p.OutputPerMTok}
+	}
+	return prices
 }
 
-func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Router, cfg *config.Config, undoMgr *fileops.UndoManager) {
+func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Router, cfg *config.Config, undoMgr *fileops.UndoManager, streams *streamRegistry, tracker *usage.Tracker, scheduler *schedule.Scheduler, pauses *pause.Manager) {
 	// Config handlers
 	server.Handle("config.get", func(ctx context.Context, params json.RawMessage) (any, error) {
 		return cfg, nil
@@ -265,6 +473,7 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 			return nil, fmt.Errorf("reload config: %w", err)
 		}
 		*cfg = *newCfg
+		tracker.SetPrices(usagePrices(cfg.LLM.Pricing))
 		logging.Info("configuration reloaded")
 		return map[string]string{"status": "reloaded"}, nil
 	})
@@ -274,6 +483,24 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 		return queue.ListTasks(100)
 	})
 
+	// One task, including the progress its handler last reported
+	server.Handle("task.get", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		t, err := queue.GetTask(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, fmt.Errorf("task %s not found", p.ID)
+		}
+		return t, nil
+	})
+
 	server.Handle("task.cancel", func(ctx context.Context, params json.RawMessage) (any, error) {
 		var p struct {
 			ID string `json:"id"`
@@ -287,6 +514,35 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 		return map[string]string{"status": "cancelled"}, nil
 	})
 
+	// Applies the configured retention policy now. Fields given override
+	// it for this call; dry_run only reports what would change.
+	server.Handle("task.prune", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			DryRun         bool `json:"dry_run"`
+			MaxAgeDays     *int `json:"max_age_days"`
+			MaxRows        *int `json:"max_rows"`
+			ScrubAfterDays *int `json:"scrub_after_days"`
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+
+		policy := queue.Retention()
+		if p.MaxAgeDays != nil {
+			policy.MaxAge = days(*p.MaxAgeDays)
+			policy.StatusMaxAge = nil
+		}
+		if p.MaxRows != nil {
+			policy.MaxRows = *p.MaxRows
+		}
+		if p.ScrubAfterDays != nil {
+			policy.ScrubAfter = days(*p.ScrubAfterDays)
+		}
+		return queue.Prune(policy, p.DryRun)
+	})
+
 	server.Handle("task.history", func(ctx context.Context, params json.RawMessage) (any, error) {
 		limit := 50
 		var p struct {
@@ -298,13 +554,212 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 		return queue.ListTasks(limit)
 	})
 
-	// Ad-hoc feature handlers (synchronous - enqueue and wait)
-	server.Handle("clipboard.summarize", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskClipboardSummarize, params, 1)
+	// Filtered, paginated task listing. With fields, each task holds only
+	// those fields and its id.
+	server.Handle("task.query", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var q task.TaskQuery
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &q); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+		page, err := queue.QueryTasks(q)
 		if err != nil {
 			return nil, err
 		}
-		return json.RawMessage(t.Result), nil
+		if len(q.Fields) == 0 {
+			return page, nil
+		}
+
+		tasks := make([]map[string]json.RawMessage, 0, len(page.Tasks))
+		for _, t := range page.Tasks {
+			projected, err := t.Project(q.Fields)
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, projected)
+		}
+		result := map[string]any{"tasks": tasks}
+		if page.NextCursor != "" {
+			result["next_cursor"] = page.NextCursor
+		}
+		return result, nil
+	})
+
+	// Failed tasks with their payloads and attempt history. Takes the same
+	// filters as task.query, except statuses and fields.
+	server.Handle("task.dead_letter", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var q task.TaskQuery
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &q); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+		q.Fields = nil
+		return queue.DeadLetters(q)
+	})
+
+	// Requeues a failed or cancelled task, replacing its payload if one is
+	// given
+	server.Handle("task.retry", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			ID      string          `json:"id"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		if p.ID == "" {
+			return nil, fmt.Errorf("id is required")
+		}
+		return queue.Retry(p.ID, p.Payload)
+	})
+
+	server.Handle("task.retry_failed", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var filter task.RetryFilter
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &filter); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+		tasks, err := queue.RetryFailed(filter)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"retried": len(tasks), "tasks": tasks}, nil
+	})
+
+	// Streams task.event notifications. With a task_id, only that task's
+	// events are sent and the call returns its final event; otherwise it runs
+	// until the client goes away.
+	server.Handle("task.subscribe", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			TaskID string `json:"task_id"`
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+
+		events, unsubscribe := queue.Subscribe(64)
+		defer unsubscribe()
+
+		if p.TaskID != "" {
+			t, err := queue.GetTask(p.TaskID)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, fmt.Errorf("task %s not found", p.TaskID)
+			}
+			ev := task.Event{TaskID: t.ID, Type: t.Type, Status: t.Status, Error: t.Error, Progress: t.Progress, Time: time.Now()}
+			if ev.Done() {
+				return ev, nil
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case ev, ok := <-events:
+				if !ok {
+					return nil, fmt.Errorf("task queue stopped")
+				}
+				if p.TaskID != "" && ev.TaskID != p.TaskID {
+					continue
+				}
+				if err := api.Notify(ctx, "task.event", ev); err != nil {
+					return nil, err
+				}
+				if p.TaskID != "" && ev.Done() {
+					return ev, nil
+				}
+			}
+		}
+	})
+
+	// Pause handlers
+	// Stops workers from claiming tasks until queue.resume, or until the
+	// given time. Running tasks finish.
+	server.Handle("queue.pause", func(ctx context.Context, params json.RawMessage) (any, error) {
+		until, err := pauseUntil(params)
+		if err != nil {
+			return nil, err
+		}
+		return pauses.Pause(pauseQueue, until)
+	})
+
+	server.Handle("queue.resume", func(ctx context.Context, params json.RawMessage) (any, error) {
+		return pauses.Resume(pauseQueue)
+	})
+
+	// Pauses one trigger: clipboard, auto_file or screenshots
+	server.Handle("trigger.pause", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		if p.Name == pauseQueue {
+			return nil, fmt.Errorf("use queue.pause to pause the queue")
+		}
+		until, err := pauseUntil(params)
+		if err != nil {
+			return nil, err
+		}
+		return pauses.Pause(p.Name, until)
+	})
+
+	server.Handle("trigger.resume", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		if p.Name == pauseQueue {
+			return nil, fmt.Errorf("use queue.resume to resume the queue")
+		}
+		return pauses.Resume(p.Name)
+	})
+
+	// Pause state of the queue and every running trigger
+	server.Handle("trigger.list", func(ctx context.Context, params json.RawMessage) (any, error) {
+		return pauses.List(), nil
+	})
+
+	// Schedule handlers
+	server.Handle("schedule.add", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p schedule.Schedule
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		return scheduler.Add(p)
+	})
+
+	server.Handle("schedule.list", func(ctx context.Context, params json.RawMessage) (any, error) {
+		return scheduler.List()
+	})
+
+	server.Handle("schedule.remove", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		if err := scheduler.Remove(p.ID); err != nil {
+			return nil, err
+		}
+		return map[string]string{"status": "removed"}, nil
+	})
+
+	// Ad-hoc feature handlers (synchronous - enqueue and wait, optionally streaming)
+	server.Handle("clipboard.summarize", func(ctx context.Context, params json.RawMessage) (any, error) {
+		return enqueueAndStream(ctx, queue, streams, task.TaskClipboardSummarize, params)
 	})
 
 	server.Handle("clipboard.get_summary", func(ctx context.Context, params json.RawMessage) (any, error) {
@@ -322,7 +777,7 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	})
 
 	server.Handle("file.classify", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskFileClassify, params, 1)
+		t, err := queue.EnqueueAndWait(ctx, task.TaskFileClassify, params, task.PriorityInteractive)
 		if err != nil {
 			return nil, err
 		}
@@ -330,7 +785,7 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	})
 
 	server.Handle("file.rename", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskFileRename, params, 1)
+		t, err := queue.EnqueueAndWait(ctx, task.TaskFileRename, params, task.PriorityInteractive)
 		if err != nil {
 			return nil, err
 		}
@@ -338,19 +793,66 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	})
 
 	server.Handle("git.generate_commit", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskGitCommit, params, 1)
+		return enqueueAndStream(ctx, queue, streams, task.TaskGitCommit, params)
+	})
+
+	server.Handle("screenshot.tag", func(ctx context.Context, params json.RawMessage) (any, error) {
+		t, err := queue.EnqueueAndWait(ctx, task.TaskScreenshotTag, params, task.PriorityInteractive)
 		if err != nil {
 			return nil, err
 		}
 		return json.RawMessage(t.Result), nil
 	})
 
-	server.Handle("screenshot.tag", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskScreenshotTag, params, 1)
+	// Usage handlers
+	server.Handle("usage.report", func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p struct {
+			Since    string `json:"since"` // YYYY-MM-DD, defaults to 30 days ago
+			Until    string `json:"until"` // YYYY-MM-DD, inclusive
+			Provider string `json:"provider"`
+			TaskType string `json:"task_type"`
+			TaskID   string `json:"task_id"`
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, fmt.Errorf("parse params: %w", err)
+			}
+		}
+
+		if p.TaskID != "" {
+			return tracker.ListByTask(p.TaskID)
+		}
+
+		q := usage.Query{
+			Since:    time.Now().AddDate(0, 0, -30),
+			Provider: p.Provider,
+			TaskType: p.TaskType,
+		}
+		var err error
+		if p.Since != "" {
+			if q.Since, err = time.ParseInLocation("2006-01-02", p.Since, time.Local); err != nil {
+				return nil, fmt.Errorf("invalid since: %w", err)
+			}
+		}
+		if p.Until != "" {
+			if q.Until, err = time.ParseInLocation("2006-01-02", p.Until, time.Local); err != nil {
+				return nil, fmt.Errorf("invalid until: %w", err)
+			}
+		}
+
+		rows, err := tracker.Report(q)
 		if err != nil {
 			return nil, err
 		}
-		return json.RawMessage(t.Result), nil
+		total := usage.Row{}
+		for _, row := range rows {
+			total.Calls += row.Calls
+			total.PromptTokens += row.PromptTokens
+			total.CompletionTokens += row.CompletionTokens
+			total.TotalTokens += row.TotalTokens
+			total.CostUSD += row.CostUSD
+		}
+		return map[string]any{"rows": rows, "total": total}, nil
 	})
 
 	// Logs handler
@@ -464,25 +966,42 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	server.Handle("pipeline.status", func(ctx context.Context, params json.RawMessage) (any, error) {
 		return map[string]any{
 			"auto_file": map[string]any{
-				"enabled":        cfg.AutoFile.Enabled && cfg.AutoFile.AutoMove,
-				"auto_move":      cfg.AutoFile.AutoMove,
-				"auto_rename":    cfg.AutoFile.AutoRename,
+				"enabled":         cfg.AutoFile.Enabled && cfg.AutoFile.AutoMove,
+				"auto_move":       cfg.AutoFile.AutoMove,
+				"auto_rename":     cfg.AutoFile.AutoRename,
 				"settle_delay_ms": cfg.AutoFile.SettleDelayMs,
-				"watch_dirs":     cfg.AutoFile.WatchDirs,
+				"watch_dirs":      cfg.AutoFile.WatchDirs,
 			},
 			"screenshot": map[string]any{
-				"enabled":        cfg.Screenshots.Enabled,
-				"use_vision":     cfg.Screenshots.UseVision,
-				"rename":         cfg.Screenshots.Rename,
+				"enabled":         cfg.Screenshots.Enabled,
+				"use_vision":      cfg.Screenshots.UseVision,
+				"rename":          cfg.Screenshots.Rename,
 				"settle_delay_ms": cfg.Screenshots.SettleDelayMs,
-				"watch_dir":      cfg.Screenshots.WatchDir,
-				"destination":    cfg.Screenshots.Destination,
+				"watch_dir":       cfg.Screenshots.WatchDir,
+				"destination":     cfg.Screenshots.Destination,
 			},
 		}, nil
 	})
 
 	server.Handle("pipeline.auto_file", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskPipelineAutoFile, params, 1)
+		var p struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("parse params: %w", err)
+		}
+		if p.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+
+		last, err := queue.EnqueueJob(autoFileSteps(p.Path), task.EnqueueOptions{
+			Priority:       task.PriorityInteractive,
+			RejectIfPaused: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		t, err := queue.Wait(ctx, last.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -490,7 +1009,7 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	})
 
 	server.Handle("pipeline.screenshot", func(ctx context.Context, params json.RawMessage) (any, error) {
-		t, err := queue.EnqueueAndWait(ctx, task.TaskPipelineScreenshot, params, 1)
+		t, err := queue.EnqueueAndWait(ctx, task.TaskPipelineScreenshot, params, task.PriorityInteractive)
 		if err != nil {
 			return nil, err
 		}
@@ -505,7 +1024,13 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 			return nil, fmt.Errorf("parse params: %w", err)
 		}
 
-		count, err := undoMgr.Undo(p.TaskID)
+		// Operations of a job are recorded under its job ID
+		undoID := p.TaskID
+		if t, err := queue.GetTask(p.TaskID); err == nil && t != nil && t.JobID != "" {
+			undoID = t.JobID
+		}
+
+		count, err := undoMgr.Undo(undoID)
 		if err != nil {
 			return nil, err
 		}
@@ -515,6 +1040,70 @@ func registerAPIHandlers(server *api.Server, queue *task.Queue, router *llm.Rout
 	})
 }
 
+// Names the queue and triggers are paused by
+const (
+	pauseQueue       = "queue"
+	pauseClipboard   = "clipboard"
+	pauseAutoFile    = "auto_file"
+	pauseScreenshots = "screenshots"
+)
+
+// pauseUntil reads when a pause ends from RPC params: an until time, or a
+// number of minutes from now. Neither means until resumed.
+func pauseUntil(params json.RawMessage) (time.Time, error) {
+	var p struct {
+		Until   *time.Time `json:"until"`
+		Minutes int        `json:"minutes"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return time.Time{}, fmt.Errorf("parse params: %w", err)
+		}
+	}
+	switch {
+	case p.Until != nil && p.Minutes != 0:
+		return time.Time{}, fmt.Errorf("set either until or minutes, not both")
+	case p.Until != nil:
+		return *p.Until, nil
+	case p.Minutes < 0:
+		return time.Time{}, fmt.Errorf("minutes must be positive")
+	case p.Minutes > 0:
+		return time.Now().Add(time.Duration(p.Minutes) * time.Minute), nil
+	}
+	return time.Time{}, nil
+}
+
+// enqueueBackground queues work discovered by a watcher, coalescing repeats
+// with the same dedupe key. Nobody waits on the result, so a rejected task
+// is logged rather than returned.
+func enqueueBackground(queue *task.Queue, taskType task.TaskType, payload []byte, dedupeKey string) {
+	_, err := queue.EnqueueWith(taskType, payload, task.EnqueueOptions{
+		Priority:  task.PriorityBackground,
+		DedupeKey: dedupeKey,
+	})
+	if err != nil {
+		logging.Warn("failed to queue %s: %v", taskType, err)
+	}
+}
+
+// enqueueBackgroundJob is enqueueBackground for a job; the dedupe key
+// applies to its last step
+func enqueueBackgroundJob(queue *task.Queue, steps []task.JobStep, dedupeKey string) {
+	_, err := queue.EnqueueJob(steps, task.EnqueueOptions{
+		Priority:  task.PriorityBackground,
+		DedupeKey: dedupeKey,
+	})
+	if err != nil {
+		logging.Warn("failed to queue %s job: %v", steps[len(steps)-1].Type, err)
+	}
+}
+
+// contentKey is a dedupe key for arbitrary text
+func contentKey(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
 func escapeJSON(s string) string {
 	// Basic JSON string escaping
 	result := ""
@@ -42,6 +42,45 @@ type pipelineStep struct {
 	Detail string `json:"detail,omitempty"`
 }
 
+// stepProgress reports a pipeline's steps as the running task's progress
+// while each starts and finishes. A step's percentage is its position in
+// steps.
+type stepProgress struct {
+	reporter *task.Reporter
+	steps    []string
+}
+
+func newStepProgress(ctx context.Context, steps ...string) *stepProgress {
+	return &stepProgress{reporter: task.ProgressFromContext(ctx), steps: steps}
+}
+
+// start reports that the named step has begun
+func (s *stepProgress) start(name string) {
+	s.reporter.Report(name, s.percent(name, false), "started")
+}
+
+// finish records step in steps and reports it done
+func (s *stepProgress) finish(steps *[]pipelineStep, step pipelineStep) {
+	*steps = append(*steps, step)
+	msg := step.Status
+	if step.Detail != "" {
+		msg += ": " + step.Detail
+	}
+	s.reporter.Report(step.Name, s.percent(step.Name, true), msg)
+}
+
+func (s *stepProgress) percent(name string, done bool) int {
+	for i, n := range s.steps {
+		if n == name {
+			if done {
+				i++
+			}
+			return i * 100 / len(s.steps)
+		}
+	}
+	return 0
+}
+
 // waitForSettle waits for a file's size to stabilize across two consecutive checks.
 func waitForSettle(ctx context.Context, path string, delayMs int) error {
 	if delayMs <= 0 {
@@ -51,7 +90,7 @@ func waitForSettle(ctx context.Context, path string, delayMs int) error {
 
 	info1, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return fmt.Errorf("file not found: %w", permanentIfMissing(err))
 	}
 
 	select {
@@ -62,7 +101,7 @@ func waitForSettle(ctx context.Context, path string, delayMs int) error {
 
 	info2, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("file disappeared: %w", err)
+		return fmt.Errorf("file disappeared: %w", permanentIfMissing(err))
 	}
 
 	if info1.Size() != info2.Size() {
@@ -75,7 +114,7 @@ func waitForSettle(ctx context.Context, path string, delayMs int) error {
 
 		info3, err := os.Stat(path)
 		if err != nil {
-			return fmt.Errorf("file disappeared: %w", err)
+			return fmt.Errorf("file disappeared: %w", permanentIfMissing(err))
 		}
 		if info2.Size() != info3.Size() {
 			return fmt.Errorf("file still changing size")
@@ -85,118 +124,295 @@ func waitForSettle(ctx context.Context, path string, delayMs int) error {
 	return nil
 }
 
-// autoFileResult is the JSON output of RunAutoFilePipeline.
-type autoFileResult struct {
-	OriginalPath string         `json:"original_path"`
-	FinalPath    string         `json:"final_path"`
-	Category     string         `json:"category"`
-	NewName      string         `json:"new_name,omitempty"`
-	Steps        []pipelineStep `json:"steps"`
+// The auto-file pipeline runs as a job so each step is visible in the queue
+// and retried on its own: classify (once the file settles), move, rename,
+// and finally auto_file.finish, which notifies and reports the outcome.
+// Every step receives the state returned by the step before it. A
+// pipeline.auto_file task queued on its own expands into this job.
+
+// autoFileSteps returns the job that files path
+func autoFileSteps(path string) []task.JobStep {
+	payload, _ := json.Marshal(map[string]string{"path": path})
+	return []task.JobStep{
+		{Type: task.TaskAutoFileClassify, Payload: payload},
+		{Type: task.TaskAutoFileMove, DependsOn: []int{0}},
+		{Type: task.TaskAutoFileRename, DependsOn: []int{1}},
+		{Type: task.TaskAutoFileFinish, DependsOn: []int{2}},
+	}
 }
 
-// RunAutoFilePipeline classifies, moves, and renames a file end-to-end.
-func (p *PipelineRunner) RunAutoFilePipeline(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+// handleAutoFileJob queues the auto-file job for the path in payload and
+// returns the IDs of the job and its final step without waiting for it
+func handleAutoFileJob(ctx context.Context, payload json.RawMessage, queue *task.Queue) (json.RawMessage, error) {
 	var params struct {
 		Path string `json:"path"`
 	}
 	if err := json.Unmarshal(payload, &params); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 	if params.Path == "" {
-		return nil, fmt.Errorf("empty path")
+		return nil, task.Permanent(fmt.Errorf("empty path"))
 	}
 
-	taskID := task.TaskIDFromContext(ctx)
-	currentPath := params.Path
-	var steps []pipelineStep
+	path := config.ExpandPath(params.Path)
+	last, err := queue.EnqueueJob(autoFileSteps(path), task.EnqueueOptions{
+		Priority:  task.PriorityBackground,
+		DedupeKey: path,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("queue job: %w", err)
+	}
+	return json.Marshal(map[string]string{"job_id": last.JobID, "task_id": last.ID})
+}
+
+// handleAutoFileSweep queues an auto-file job for every file directly inside
+// a directory, skipping the files the watcher would skip
+func handleAutoFileSweep(ctx context.Context, payload json.RawMessage, queue *task.Queue, cfg *config.Config) (json.RawMessage, error) {
+	var params struct {
+		Dir string `json:"dir"`
+	}
+	if err := json.Unmarshal(payload, &params); err != nil {
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
+	}
+	if params.Dir == "" {
+		return nil, task.Permanent(fmt.Errorf("empty dir"))
+	}
+	dir := config.ExpandPath(params.Dir)
 
-	logging.Info("pipeline.auto_file: starting for %s", filepath.Base(currentPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", permanentIfMissing(err))
+	}
 
-	// 1. Settle
-	if err := waitForSettle(ctx, currentPath, p.cfg.AutoFile.SettleDelayMs); err != nil {
+	queued := 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		name := entry.Name()
+		if entry.IsDir() || (cfg.AutoFile.IgnoreHidden && strings.HasPrefix(name, ".")) || excluded(name, cfg.AutoFile.ExcludePatterns) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if cfg.Screenshots.Enabled && isImageExtension(path) {
+			continue
+		}
+		enqueueBackgroundJob(queue, autoFileSteps(path), path)
+		queued++
+	}
+
+	logging.Info("auto_file.sweep: queued %d files from %s", queued, dir)
+	return json.Marshal(map[string]any{"dir": dir, "queued": queued})
+}
+
+func excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// autoFileState is passed from step to step of an auto-file job
+type autoFileState struct {
+	OriginalPath string         `json:"original_path"`
+	Path         string         `json:"path"`
+	Category     string         `json:"category,omitempty"`
+	Destination  string         `json:"destination,omitempty"`
+	NewName      string         `json:"new_name,omitempty"`
+	Steps        []pipelineStep `json:"steps,omitempty"`
+}
+
+func parseAutoFileState(payload json.RawMessage) (*autoFileState, error) {
+	var state autoFileState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
+	}
+	if state.Path == "" {
+		return nil, task.Permanent(fmt.Errorf("empty path"))
+	}
+	if state.OriginalPath == "" {
+		state.OriginalPath = state.Path
+	}
+	return &state, nil
+}
+
+// autoFileResult is the JSON output of the auto-file job.
+type autoFileResult struct {
+	JobID        string         `json:"job_id,omitempty"`
+	OriginalPath string         `json:"original_path"`
+	FinalPath    string         `json:"final_path"`
+	Category     string         `json:"category"`
+	NewName      string         `json:"new_name,omitempty"`
+	Steps        []pipelineStep `json:"steps"`
+}
+
+// ClassifyAutoFile waits for a file to settle and picks its category and
+// destination.
+func (p *PipelineRunner) ClassifyAutoFile(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	state, err := parseAutoFileState(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Info("pipeline.auto_file: starting for %s", filepath.Base(state.Path))
+	prog := newStepProgress(ctx, "settle", "classify")
+
+	prog.start("settle")
+	if err := waitForSettle(ctx, state.Path, p.cfg.AutoFile.SettleDelayMs); err != nil {
 		return nil, fmt.Errorf("settle: %w", err)
 	}
-	steps = append(steps, pipelineStep{Name: "settle", Status: "ok"})
+	prog.finish(&state.Steps, pipelineStep{Name: "settle", Status: "ok"})
 
-	// 2. Classify
-	classifyPayload, _ := json.Marshal(map[string]string{"path": currentPath})
+	prog.start("classify")
+	classifyPayload, _ := json.Marshal(map[string]string{"path": state.Path})
 	classifyRaw, err := handleFileClassify(ctx, classifyPayload, p.router, p.cfg)
 	if err != nil {
 		return nil, fmt.Errorf("classify: %w", err)
 	}
 	var cr classifyResult
 	json.Unmarshal(classifyRaw, &cr)
-	steps = append(steps, pipelineStep{Name: "classify", Status: "ok", Detail: cr.Category})
+	state.Category = cr.Category
+	state.Destination = cr.Destination
+	prog.finish(&state.Steps, pipelineStep{Name: "classify", Status: "ok", Detail: cr.Category})
+
+	return json.Marshal(state)
+}
+
+// MoveAutoFile moves the file to its category's destination, if enabled.
+// A failed move is recorded and the job carries on.
+func (p *PipelineRunner) MoveAutoFile(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	if done, err := finishedAutoFileStep(ctx); done != nil || err != nil {
+		return done, err
+	}
+	state, err := parseAutoFileState(payload)
+	if err != nil {
+		return nil, err
+	}
 
-	// 3. Move (if enabled and destination differs)
-	if p.cfg.AutoFile.AutoMove && cr.Destination != "" && cr.Destination != currentPath {
-		actualDst, err := fileops.MoveFile(currentPath, cr.Destination)
+	if p.cfg.AutoFile.AutoMove && state.Destination != "" && state.Destination != state.Path {
+		prog := newStepProgress(ctx, "move")
+		prog.start("move")
+		actualDst, err := fileops.MoveFile(state.Path, state.Destination)
 		if err != nil {
-			steps = append(steps, pipelineStep{Name: "move", Status: "error", Detail: err.Error()})
+			prog.finish(&state.Steps, pipelineStep{Name: "move", Status: "error", Detail: err.Error()})
 		} else {
-			if taskID != "" {
-				p.undoMgr.Record(fileops.Operation{
-					ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
-					TaskID:       taskID,
-					Type:         fileops.OpMove,
-					OriginalPath: currentPath,
-					NewPath:      actualDst,
-					CreatedAt:    time.Now(),
-				})
-			}
-			steps = append(steps, pipelineStep{Name: "move", Status: "ok", Detail: actualDst})
-			currentPath = actualDst
+			p.recordUndo(ctx, fileops.OpMove, state.Path, actualDst)
+			prog.finish(&state.Steps, pipelineStep{Name: "move", Status: "ok", Detail: actualDst})
+			state.Path = actualDst
+			checkpointAutoFile(ctx, state)
 		}
 	}
 
-	// 4. Rename (if enabled, best-effort)
-	var newName string
-	if p.cfg.AutoFile.AutoRename {
-		renamePayload, _ := json.Marshal(map[string]string{"path": currentPath})
-		renameRaw, err := handleFileRename(ctx, renamePayload, p.router, p.cfg)
+	return json.Marshal(state)
+}
+
+// RenameAutoFile gives the file a suggested name, if enabled. Failing to get
+// a suggestion is retried; a failed rename is recorded and the job carries on.
+func (p *PipelineRunner) RenameAutoFile(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	if done, err := finishedAutoFileStep(ctx); done != nil || err != nil {
+		return done, err
+	}
+	state, err := parseAutoFileState(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !p.cfg.AutoFile.AutoRename {
+		return json.Marshal(state)
+	}
+
+	prog := newStepProgress(ctx, "rename")
+	prog.start("rename")
+	renamePayload, _ := json.Marshal(map[string]string{"path": state.Path})
+	renameRaw, err := handleFileRename(ctx, renamePayload, p.router, p.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("rename: %w", err)
+	}
+	var rr renameResult
+	json.Unmarshal(renameRaw, &rr)
+	if rr.NewName != "" && rr.NewName != filepath.Base(state.Path) {
+		actualDst, err := fileops.RenameFile(state.Path, rr.NewName)
 		if err != nil {
-			steps = append(steps, pipelineStep{Name: "rename", Status: "error", Detail: err.Error()})
+			prog.finish(&state.Steps, pipelineStep{Name: "rename", Status: "error", Detail: err.Error()})
 		} else {
-			var rr renameResult
-			json.Unmarshal(renameRaw, &rr)
-			if rr.NewName != "" && rr.NewName != filepath.Base(currentPath) {
-				actualDst, err := fileops.RenameFile(currentPath, rr.NewName)
-				if err != nil {
-					steps = append(steps, pipelineStep{Name: "rename", Status: "error", Detail: err.Error()})
-				} else {
-					if taskID != "" {
-						p.undoMgr.Record(fileops.Operation{
-							ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
-							TaskID:       taskID,
-							Type:         fileops.OpRename,
-							OriginalPath: currentPath,
-							NewPath:      actualDst,
-							CreatedAt:    time.Now(),
-						})
-					}
-					newName = rr.NewName
-					steps = append(steps, pipelineStep{Name: "rename", Status: "ok", Detail: rr.NewName})
-					currentPath = actualDst
-				}
-			}
+			p.recordUndo(ctx, fileops.OpRename, state.Path, actualDst)
+			state.NewName = rr.NewName
+			prog.finish(&state.Steps, pipelineStep{Name: "rename", Status: "ok", Detail: rr.NewName})
+			state.Path = actualDst
+			checkpointAutoFile(ctx, state)
 		}
 	}
 
-	// 5. Notify
-	p.notifier.SendWithSubtitle("Bender", "Auto-filed", fmt.Sprintf("%s → %s", filepath.Base(params.Path), cr.Category))
+	return json.Marshal(state)
+}
+
+// checkpointAutoFile saves the state a step ends with once its file
+// operation is done, so the operation is not repeated if the task is
+// interrupted before it completes
+func checkpointAutoFile(ctx context.Context, state *autoFileState) {
+	if err := task.Checkpoint(ctx, state); err != nil {
+		logging.Warn("pipeline.auto_file: %v", err)
+	}
+}
+
+// finishedAutoFileStep returns the state an earlier attempt of the running
+// step checkpointed, or nil if it has not done its file operation
+func finishedAutoFileStep(ctx context.Context) (json.RawMessage, error) {
+	var state autoFileState
+	ok, err := task.LastCheckpoint(ctx, &state)
+	if err != nil {
+		return nil, task.Permanent(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	logging.Info("pipeline.auto_file: %s already done, resuming", filepath.Base(state.Path))
+	return json.Marshal(state)
+}
+
+// FinishAutoFile notifies the user and reports what the job did.
+func (p *PipelineRunner) FinishAutoFile(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	state, err := parseAutoFileState(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	p.notifier.SendWithSubtitle("Bender", "Auto-filed", fmt.Sprintf("%s → %s", filepath.Base(state.OriginalPath), state.Category))
 
 	result := autoFileResult{
-		OriginalPath: params.Path,
-		FinalPath:    currentPath,
-		Category:     cr.Category,
-		NewName:      newName,
-		Steps:        steps,
+		JobID:        task.JobIDFromContext(ctx),
+		OriginalPath: state.OriginalPath,
+		FinalPath:    state.Path,
+		Category:     state.Category,
+		NewName:      state.NewName,
+		Steps:        state.Steps,
 	}
 
-	logging.Info("pipeline.auto_file: completed %s → %s (%s)", filepath.Base(params.Path), cr.Category, currentPath)
+	logging.Info("pipeline.auto_file: completed %s → %s (%s)", filepath.Base(state.OriginalPath), state.Category, state.Path)
 	return json.Marshal(result)
 }
 
+// recordUndo records a file operation so it can be undone. Operations of a
+// job are grouped under its job ID.
+func (p *PipelineRunner) recordUndo(ctx context.Context, opType fileops.OperationType, from, to string) {
+	id := task.JobIDFromContext(ctx)
+	if id == "" {
+		id = task.TaskIDFromContext(ctx)
+	}
+	if id == "" {
+		return
+	}
+	p.undoMgr.Record(fileops.Operation{
+		ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
+		TaskID:       id,
+		Type:         opType,
+		OriginalPath: from,
+		NewPath:      to,
+		CreatedAt:    time.Now(),
+	})
+}
+
 // screenshotPipelineResult is the JSON output of RunScreenshotPipeline.
 type screenshotPipelineResult struct {
 	OriginalPath string         `json:"original_path"`
@@ -207,104 +423,148 @@ type screenshotPipelineResult struct {
 	Steps        []pipelineStep `json:"steps"`
 }
 
+// Stages of the screenshot pipeline, checkpointed as each completes so an
+// interrupted run never repeats a rename or move
+const (
+	screenshotTagged = iota + 1
+	screenshotRenamed
+	screenshotMoved
+)
+
+// screenshotState is the checkpointed progress of RunScreenshotPipeline
+type screenshotState struct {
+	Stage int              `json:"stage"`
+	Path  string           `json:"path"`
+	Tag   screenshotResult `json:"tag"`
+	Steps []pipelineStep   `json:"steps,omitempty"`
+}
+
 // RunScreenshotPipeline tags, renames, and moves a screenshot end-to-end.
+// A run interrupted by a restart or retried after an error resumes after
+// its last completed stage.
 func (p *PipelineRunner) RunScreenshotPipeline(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
 	var params struct {
 		Path string `json:"path"`
 	}
 	if err := json.Unmarshal(payload, &params); err != nil {
-		return nil, fmt.Errorf("parse payload: %w", err)
+		return nil, task.Permanent(fmt.Errorf("parse payload: %w", err))
 	}
 	if params.Path == "" {
-		return nil, fmt.Errorf("empty path")
+		return nil, task.Permanent(fmt.Errorf("empty path"))
 	}
 
 	taskID := task.TaskIDFromContext(ctx)
-	currentPath := params.Path
-	var steps []pipelineStep
-
-	logging.Info("pipeline.screenshot: starting for %s", filepath.Base(currentPath))
+	state := screenshotState{Path: params.Path}
+	resumed, err := task.LastCheckpoint(ctx, &state)
+	if err != nil {
+		return nil, task.Permanent(err)
+	}
+	prog := newStepProgress(ctx, "settle", "tag", "rename", "move")
+	checkpoint := func(stage int) {
+		state.Stage = stage
+		if err := task.Checkpoint(ctx, state); err != nil {
+			logging.Warn("pipeline.screenshot: %v", err)
+		}
+	}
 
-	// 1. Settle
-	if err := waitForSettle(ctx, currentPath, p.cfg.Screenshots.SettleDelayMs); err != nil {
-		return nil, fmt.Errorf("settle: %w", err)
+	if resumed {
+		logging.Info("pipeline.screenshot: resuming %s at stage %d", filepath.Base(state.Path), state.Stage)
+	} else {
+		logging.Info("pipeline.screenshot: starting for %s", filepath.Base(state.Path))
 	}
-	steps = append(steps, pipelineStep{Name: "settle", Status: "ok"})
 
-	// 2. Tag via vision
-	var sr screenshotResult
-	if p.cfg.Screenshots.UseVision {
-		tagPayload, _ := json.Marshal(map[string]string{"path": currentPath})
-		tagRaw, err := handleScreenshotTag(ctx, tagPayload, p.router, p.cfg)
-		if err != nil {
-			return nil, fmt.Errorf("tag: %w", err)
+	// 1. Settle, then tag via vision
+	if state.Stage < screenshotTagged {
+		prog.start("settle")
+		if err := waitForSettle(ctx, state.Path, p.cfg.Screenshots.SettleDelayMs); err != nil {
+			return nil, fmt.Errorf("settle: %w", err)
 		}
-		json.Unmarshal(tagRaw, &sr)
-		steps = append(steps, pipelineStep{Name: "tag", Status: "ok", Detail: sr.Description})
-	}
+		prog.finish(&state.Steps, pipelineStep{Name: "settle", Status: "ok"})
 
-	// 3. Rename (if enabled and suggested name available, best-effort)
-	if p.cfg.Screenshots.Rename && sr.SuggestedName != "" && sr.SuggestedName != filepath.Base(currentPath) {
-		actualDst, err := fileops.RenameFile(currentPath, sr.SuggestedName)
-		if err != nil {
-			steps = append(steps, pipelineStep{Name: "rename", Status: "error", Detail: err.Error()})
-		} else {
-			if taskID != "" {
-				p.undoMgr.Record(fileops.Operation{
-					ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
-					TaskID:       taskID,
-					Type:         fileops.OpRename,
-					OriginalPath: currentPath,
-					NewPath:      actualDst,
-					CreatedAt:    time.Now(),
-				})
+		if p.cfg.Screenshots.UseVision {
+			prog.start("tag")
+			tagPayload, _ := json.Marshal(map[string]string{"path": state.Path})
+			tagRaw, err := handleScreenshotTag(ctx, tagPayload, p.router, p.cfg)
+			if err != nil {
+				return nil, fmt.Errorf("tag: %w", err)
 			}
-			steps = append(steps, pipelineStep{Name: "rename", Status: "ok", Detail: sr.SuggestedName})
-			currentPath = actualDst
+			json.Unmarshal(tagRaw, &state.Tag)
+			prog.finish(&state.Steps, pipelineStep{Name: "tag", Status: "ok", Detail: state.Tag.Description})
 		}
+		checkpoint(screenshotTagged)
 	}
+	sr := state.Tag
 
-	// 4. Move to destination (if configured)
-	if p.cfg.Screenshots.Destination != "" {
-		dest := filepath.Join(p.cfg.Screenshots.Destination, filepath.Base(currentPath))
-		if dest != currentPath {
-			actualDst, err := fileops.MoveFile(currentPath, dest)
+	// 2. Rename (if enabled and suggested name available, best-effort)
+	if state.Stage < screenshotRenamed {
+		if p.cfg.Screenshots.Rename && sr.SuggestedName != "" && sr.SuggestedName != filepath.Base(state.Path) {
+			prog.start("rename")
+			actualDst, err := fileops.RenameFile(state.Path, sr.SuggestedName)
 			if err != nil {
-				steps = append(steps, pipelineStep{Name: "move", Status: "error", Detail: err.Error()})
+				prog.finish(&state.Steps, pipelineStep{Name: "rename", Status: "error", Detail: err.Error()})
 			} else {
 				if taskID != "" {
 					p.undoMgr.Record(fileops.Operation{
 						ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
 						TaskID:       taskID,
-						Type:         fileops.OpMove,
-						OriginalPath: currentPath,
+						Type:         fileops.OpRename,
+						OriginalPath: state.Path,
 						NewPath:      actualDst,
 						CreatedAt:    time.Now(),
 					})
 				}
-				steps = append(steps, pipelineStep{Name: "move", Status: "ok", Detail: actualDst})
-				currentPath = actualDst
+				prog.finish(&state.Steps, pipelineStep{Name: "rename", Status: "ok", Detail: sr.SuggestedName})
+				state.Path = actualDst
+			}
+		}
+		checkpoint(screenshotRenamed)
+	}
+
+	// 3. Move to destination (if configured)
+	if state.Stage < screenshotMoved {
+		if p.cfg.Screenshots.Destination != "" {
+			dest := filepath.Join(p.cfg.Screenshots.Destination, filepath.Base(state.Path))
+			if dest != state.Path {
+				prog.start("move")
+				actualDst, err := fileops.MoveFile(state.Path, dest)
+				if err != nil {
+					prog.finish(&state.Steps, pipelineStep{Name: "move", Status: "error", Detail: err.Error()})
+				} else {
+					if taskID != "" {
+						p.undoMgr.Record(fileops.Operation{
+							ID:           fmt.Sprintf("%d", time.Now().UnixNano()),
+							TaskID:       taskID,
+							Type:         fileops.OpMove,
+							OriginalPath: state.Path,
+							NewPath:      actualDst,
+							CreatedAt:    time.Now(),
+						})
+					}
+					prog.finish(&state.Steps, pipelineStep{Name: "move", Status: "ok", Detail: actualDst})
+					state.Path = actualDst
+				}
 			}
 		}
+		checkpoint(screenshotMoved)
 	}
 
-	// 5. Notify
+	// 4. Notify
 	desc := sr.Description
 	if desc == "" {
-		desc = filepath.Base(currentPath)
+		desc = filepath.Base(state.Path)
 	}
 	p.notifier.SendWithSubtitle("Bender", "Screenshot processed", desc)
 
 	result := screenshotPipelineResult{
 		OriginalPath: params.Path,
-		FinalPath:    currentPath,
+		FinalPath:    state.Path,
 		App:          sr.App,
 		Description:  sr.Description,
 		Tags:         sr.Tags,
-		Steps:        steps,
+		Steps:        state.Steps,
 	}
 
-	logging.Info("pipeline.screenshot: completed %s → %s", filepath.Base(params.Path), currentPath)
+	logging.Info("pipeline.screenshot: completed %s → %s", filepath.Base(params.Path), state.Path)
 	return json.Marshal(result)
 }
 
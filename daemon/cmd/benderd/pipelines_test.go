@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/user/bender/internal/config"
+	"github.com/user/bender/internal/fileops"
+	"github.com/user/bender/internal/notify"
+	"github.com/user/bender/internal/task"
 )
 
 func TestWaitForSettle(t *testing.T) {
@@ -64,6 +71,55 @@ func TestWaitForSettleFileDisappears(t *testing.T) {
 	}
 }
 
+func TestAutoFileSteps(t *testing.T) {
+	steps := autoFileSteps(`/tmp/a "b".pdf`)
+	if len(steps) != 4 || steps[len(steps)-1].Type != task.TaskAutoFileFinish {
+		t.Fatalf("unexpected steps: %+v", steps)
+	}
+	for i, step := range steps[1:] {
+		if len(step.DependsOn) != 1 || step.DependsOn[0] != i {
+			t.Errorf("step %d (%s) should depend on step %d, got %v", i+1, step.Type, i, step.DependsOn)
+		}
+	}
+
+	state, err := parseAutoFileState(steps[0].Payload)
+	if err != nil {
+		t.Fatalf("parseAutoFileState: %v", err)
+	}
+	if state.Path != `/tmp/a "b".pdf` || state.OriginalPath != state.Path {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
+
+func TestMoveAutoFileCarriesState(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.pdf")
+	os.WriteFile(src, []byte("pdf"), 0644)
+	dst := filepath.Join(dir, "Documents", "report.pdf")
+
+	cfg := &config.Config{}
+	cfg.AutoFile.AutoMove = true
+	p := NewPipelineRunner(nil, cfg, nil, nil)
+
+	payload, _ := json.Marshal(autoFileState{OriginalPath: src, Path: src, Category: "Documents", Destination: dst})
+	raw, err := p.MoveAutoFile(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("MoveAutoFile: %v", err)
+	}
+
+	var state autoFileState
+	json.Unmarshal(raw, &state)
+	if state.Path != dst || state.OriginalPath != src || state.Category != "Documents" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if len(state.Steps) != 1 || state.Steps[0].Status != "ok" {
+		t.Errorf("expected a successful move step, got %+v", state.Steps)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("file not moved: %v", err)
+	}
+}
+
 func TestIsImageExtension(t *testing.T) {
 	tests := []struct {
 		path string
@@ -88,3 +144,122 @@ func TestIsImageExtension(t *testing.T) {
 		}
 	}
 }
+
+func TestMoveAutoFileResumesAfterInterruption(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.pdf")
+	os.WriteFile(src, []byte("pdf"), 0644)
+	dst := filepath.Join(dir, "Documents", "report.pdf")
+
+	dbPath := filepath.Join(dir, "test.db")
+	undoMgr, err := fileops.NewUndoManager(dbPath)
+	if err != nil {
+		t.Fatalf("NewUndoManager: %v", err)
+	}
+	defer undoMgr.Close()
+	queue, err := task.NewQueue(task.Config{DBPath: dbPath, MaxWorkers: 1, RetryDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.AutoFile.AutoMove = true
+	p := NewPipelineRunner(nil, cfg, undoMgr, nil)
+
+	// The first attempt dies after the move but before its result is saved
+	attempts := 0
+	queue.RegisterHandler(task.TaskAutoFileMove, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		attempts++
+		raw, err := p.MoveAutoFile(ctx, payload)
+		if attempts == 1 {
+			return nil, fmt.Errorf("interrupted")
+		}
+		return raw, err
+	})
+	queue.Start()
+	defer queue.Stop()
+
+	payload, _ := json.Marshal(autoFileState{OriginalPath: src, Path: src, Category: "Documents", Destination: dst})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := queue.EnqueueAndWait(ctx, task.TaskAutoFileMove, payload, task.PriorityInteractive)
+	if err != nil {
+		t.Fatalf("EnqueueAndWait: %v", err)
+	}
+
+	var state autoFileState
+	json.Unmarshal(result.Result, &state)
+	if attempts != 2 || state.Path != dst {
+		t.Fatalf("expected the retry to pick up the moved file, got %d attempts and %+v", attempts, state)
+	}
+	if len(state.Steps) != 1 || state.Steps[0].Status != "ok" {
+		t.Errorf("expected one successful move step, got %+v", state.Steps)
+	}
+}
+
+func TestPipelineAutoFileTaskRunsJob(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.pdf")
+	os.WriteFile(src, []byte("pdf"), 0644)
+	dst := filepath.Join(dir, "Documents", "report.pdf")
+
+	dbPath := filepath.Join(dir, "test.db")
+	undoMgr, err := fileops.NewUndoManager(dbPath)
+	if err != nil {
+		t.Fatalf("NewUndoManager: %v", err)
+	}
+	defer undoMgr.Close()
+	queue, err := task.NewQueue(task.Config{DBPath: dbPath, MaxWorkers: 1, RetryDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.AutoFile.AutoMove = true
+	cfg.AutoFile.Categories = []config.Category{{Name: "Documents", Path: filepath.Join(dir, "Documents"), Extensions: []string{"pdf"}}}
+	registerTaskHandlers(queue, nil, cfg, NewPipelineRunner(nil, cfg, undoMgr, notify.New(notify.Config{})), nil, undoMgr)
+	queue.Start()
+	defer queue.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payload, _ := json.Marshal(map[string]string{"path": src})
+	entry, err := queue.EnqueueAndWait(ctx, task.TaskPipelineAutoFile, payload, task.PriorityInteractive)
+	if err != nil {
+		t.Fatalf("EnqueueAndWait: %v", err)
+	}
+	var queued struct {
+		TaskID string `json:"task_id"`
+	}
+	json.Unmarshal(entry.Result, &queued)
+	finish, err := queue.Wait(ctx, queued.TaskID)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if finish.Type != task.TaskAutoFileFinish || finish.Status != task.StatusCompleted {
+		t.Fatalf("expected the job's finish step to complete, got %s %s: %s", finish.Type, finish.Status, finish.Error)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("file not moved: %v", err)
+	}
+}
+
+func TestStepProgressPercent(t *testing.T) {
+	s := newStepProgress(context.Background(), "settle", "tag", "rename", "move")
+	if got := s.percent("settle", false); got != 0 {
+		t.Errorf("settle started: got %d", got)
+	}
+	if got := s.percent("tag", true); got != 50 {
+		t.Errorf("tag finished: got %d", got)
+	}
+	if got := s.percent("move", true); got != 100 {
+		t.Errorf("move finished: got %d", got)
+	}
+
+	// Reporting outside a task is a no-op
+	var steps []pipelineStep
+	s.finish(&steps, pipelineStep{Name: "settle", Status: "ok"})
+	if len(steps) != 1 {
+		t.Errorf("expected the step recorded, got %+v", steps)
+	}
+}
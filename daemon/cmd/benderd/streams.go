@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/bender/internal/api"
+	"github.com/user/bender/internal/llm"
+	"github.com/user/bender/internal/task"
+)
+
+// streamRegistry routes streamed LLM output from task handlers running on
+// queue workers back to the RPC connection that requested it. Handlers find
+// their sink through the stream_id the RPC handler injects into the payload.
+type streamRegistry struct {
+	mu    sync.RWMutex
+	sinks map[string]*streamSink
+}
+
+// streamSink receives the output of one streamed task. When the queue
+// retries the task after some output was sent, reset is called before the
+// new attempt streams, so the client can discard the partial text.
+type streamSink struct {
+	delta   llm.StreamFunc
+	reset   func() error
+	emitted atomic.Bool
+}
+
+// begin starts an attempt, resetting the client if an earlier one streamed
+func (s *streamSink) begin() error {
+	if s.emitted.Swap(false) {
+		return s.reset()
+	}
+	return nil
+}
+
+func (s *streamSink) write(delta string) error {
+	s.emitted.Store(true)
+	return s.delta(delta)
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{sinks: make(map[string]*streamSink)}
+}
+
+// open registers a sink and returns its stream ID and a function to
+// unregister it.
+func (s *streamRegistry) open(delta llm.StreamFunc, reset func() error) (string, func()) {
+	id := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	s.mu.Lock()
+	s.sinks[id] = &streamSink{delta: delta, reset: reset}
+	s.mu.Unlock()
+
+	return id, func() {
+		s.mu.Lock()
+		delete(s.sinks, id)
+		s.mu.Unlock()
+	}
+}
+
+// get returns the sink for id, or nil if nobody is listening.
+func (s *streamRegistry) get(id string) *streamSink {
+	if s == nil || id == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sinks[id]
+}
+
+// complete streams req to the sink registered for streamID, or falls back
+// to a regular completion when there is none.
+func (s *streamRegistry) complete(ctx context.Context, router *llm.Router, streamID string, req llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	if sink := s.get(streamID); sink != nil {
+		if err := sink.begin(); err != nil {
+			return nil, err
+		}
+		return router.Stream(ctx, req, sink.write)
+	}
+	return router.Complete(ctx, req)
+}
+
+// enqueueAndStream runs a task synchronously like queue.EnqueueAndWait. When
+// params contain "stream": true, generated text is pushed to the client as
+// stream.delta notifications while the task runs. If the task is retried
+// after streaming part of its output, a stream.reset notification tells the
+// client to drop what it has received so far.
+func enqueueAndStream(ctx context.Context, queue *task.Queue, streams *streamRegistry, taskType task.TaskType, params json.RawMessage) (any, error) {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("parse params: %w", err)
+	}
+
+	var stream bool
+	if raw, ok := p["stream"]; ok {
+		if err := json.Unmarshal(raw, &stream); err != nil {
+			return nil, fmt.Errorf("parse stream: %w", err)
+		}
+	}
+
+	if stream {
+		id, closeStream := streams.open(func(delta string) error {
+			return api.Notify(ctx, "stream.delta", map[string]string{"delta": delta})
+		}, func() error {
+			return api.Notify(ctx, "stream.reset", map[string]string{})
+		})
+		defer closeStream()
+
+		delete(p, "stream")
+		p["stream_id"], _ = json.Marshal(id)
+		payload, err := json.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("encode payload: %w", err)
+		}
+		params = payload
+	}
+
+	t, err := queue.EnqueueAndWait(ctx, taskType, params, task.PriorityInteractive)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(t.Result), nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestStreamSinkResetsOnRetry(t *testing.T) {
+	streams := newStreamRegistry()
+	var deltas []string
+	resets := 0
+	id, closeStream := streams.open(func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	}, func() error {
+		resets++
+		deltas = nil
+		return nil
+	})
+	defer closeStream()
+
+	sink := streams.get(id)
+	sink.begin()
+	sink.write("partial")
+
+	// A retry after partial output resets the client first
+	sink.begin()
+	if resets != 1 || len(deltas) != 0 {
+		t.Fatalf("expected one reset clearing the output, got %d resets and %v", resets, deltas)
+	}
+	sink.write("full")
+
+	// A retry that streamed nothing needs no reset
+	sink.begin()
+	sink.begin()
+	if resets != 2 {
+		t.Errorf("expected no reset after an attempt with no output, got %d resets", resets)
+	}
+}
@@ -5,28 +5,41 @@ import (
 	"encoding/json"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 )
 
 type DaemonStatus struct {
-	Running   bool      `json:"running"`
-	Version   string    `json:"version"`
-	Uptime    string    `json:"uptime"`
-	StartedAt time.Time `json:"started_at"`
-	PID       int       `json:"pid"`
-	GoVersion string    `json:"go_version"`
+	Running   bool           `json:"running"`
+	Version   string         `json:"version"`
+	Uptime    string         `json:"uptime"`
+	StartedAt time.Time      `json:"started_at"`
+	PID       int            `json:"pid"`
+	GoVersion string         `json:"go_version"`
+	Stats     map[string]any `json:"stats,omitempty"`
 }
 
 type HealthCheck struct {
 	Status    string            `json:"status"`
 	Checks    map[string]string `json:"checks"`
+	Details   map[string]any    `json:"details,omitempty"`
 	Timestamp time.Time         `json:"timestamp"`
 }
 
+// CheckFunc reports the status of a dependency ("ok", "degraded" or "down")
+// and optional detail to include in the health response.
+type CheckFunc func() (status string, detail any)
+
+// StatsFunc returns a component's counters for status.get
+type StatsFunc func() any
+
 type StatusHandler struct {
 	version   string
 	startedAt time.Time
 	pid       int
+	checks    map[string]CheckFunc
+	stats     map[string]StatsFunc
+	mu        sync.RWMutex
 }
 
 func NewStatusHandler(version string) *StatusHandler {
@@ -34,39 +47,86 @@ func NewStatusHandler(version string) *StatusHandler {
 		version:   version,
 		startedAt: time.Now(),
 		pid:       getpid(),
+		checks:    make(map[string]CheckFunc),
+		stats:     make(map[string]StatsFunc),
 	}
 }
 
+// AddCheck registers a named health check reported by status.health
+func (h *StatusHandler) AddCheck(name string, fn CheckFunc) {
+	h.mu.Lock()
+	h.checks[name] = fn
+	h.mu.Unlock()
+}
+
+// AddStats registers named counters reported by status.get
+func (h *StatusHandler) AddStats(name string, fn StatsFunc) {
+	h.mu.Lock()
+	h.stats[name] = fn
+	h.mu.Unlock()
+}
+
 func getpid() int {
 	return os.Getpid()
 }
 
 func (h *StatusHandler) HandleStatus(ctx context.Context, params json.RawMessage) (any, error) {
-	return DaemonStatus{
+	status := DaemonStatus{
 		Running:   true,
 		Version:   h.version,
 		Uptime:    time.Since(h.startedAt).Round(time.Second).String(),
 		StartedAt: h.startedAt,
 		PID:       h.pid,
 		GoVersion: runtime.Version(),
-	}, nil
+	}
+
+	h.mu.RLock()
+	if len(h.stats) > 0 {
+		status.Stats = make(map[string]any, len(h.stats))
+		for name, fn := range h.stats {
+			status.Stats[name] = fn()
+		}
+	}
+	h.mu.RUnlock()
+
+	return status, nil
 }
 
 func (h *StatusHandler) HandleHealth(ctx context.Context, params json.RawMessage) (any, error) {
 	checks := map[string]string{
 		"daemon": "ok",
 	}
+	details := make(map[string]any)
+	status := "healthy"
 
-	return HealthCheck{
-		Status:    "healthy",
+	h.mu.RLock()
+	for name, fn := range h.checks {
+		result, detail := fn()
+		checks[name] = result
+		if detail != nil {
+			details[name] = detail
+		}
+		if result != "ok" {
+			status = "degraded"
+		}
+	}
+	h.mu.RUnlock()
+
+	health := HealthCheck{
+		Status:    status,
 		Checks:    checks,
 		Timestamp: time.Now(),
-	}, nil
+	}
+	if len(details) > 0 {
+		health.Details = details
+	}
+	return health, nil
 }
 
 // RegisterStatusHandlers registers status-related handlers on the server
-func RegisterStatusHandlers(s *Server, version string) {
+func RegisterStatusHandlers(s *Server, version string) *StatusHandler {
 	h := NewStatusHandler(version)
 	s.Handle("status.get", h.HandleStatus)
 	s.Handle("status.health", h.HandleHealth)
+	return h
 }
@@ -29,6 +29,15 @@ type Response struct {
 	ID      any    `json:"id"`
 }
 
+// Notification is a JSON-RPC 2.0 notification: a message without an ID that
+// expects no response. The server uses it to push stream chunks to a client
+// while a request is still being handled.
+type Notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -46,6 +55,36 @@ const (
 
 type Handler func(ctx context.Context, params json.RawMessage) (any, error)
 
+// connKey is the context key under which the current connection's writer is stored
+type connKey struct{}
+
+// connWriter serializes writes to a connection so notifications sent from
+// other goroutines never interleave with responses.
+type connWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (w *connWriter) write(v any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(v)
+}
+
+// Notify sends a JSON-RPC notification to the client whose request is being
+// handled in ctx. It returns an error if ctx does not carry a connection.
+func Notify(ctx context.Context, method string, params any) error {
+	w, ok := ctx.Value(connKey{}).(*connWriter)
+	if !ok {
+		return fmt.Errorf("no client connection in context")
+	}
+	return w.write(Notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
 type Server struct {
 	socketPath string
 	listener   net.Listener
@@ -120,7 +159,8 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
 	scanner := bufio.NewScanner(conn)
-	encoder := json.NewEncoder(conn)
+	writer := &connWriter{encoder: json.NewEncoder(conn)}
+	ctx = context.WithValue(ctx, connKey{}, writer)
 
 	for scanner.Scan() {
 		select {
@@ -145,12 +185,12 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 				},
 				ID: nil,
 			}
-			encoder.Encode(resp)
+			writer.write(resp)
 			continue
 		}
 
 		resp := s.handleRequest(ctx, &req)
-		if err := encoder.Encode(resp); err != nil {
+		if err := writer.write(resp); err != nil {
 			logging.Error("encode response: %v", err)
 			return
 		}
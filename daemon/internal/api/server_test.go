@@ -250,6 +250,51 @@ func TestStatusHandlers(t *testing.T) {
 	}
 }
 
+func TestHealthChecksDegraded(t *testing.T) {
+	h := NewStatusHandler("1.0.0-test")
+	h.AddCheck("llm.ollama", func() (string, any) {
+		return "down", map[string]string{"last_error": "connection refused"}
+	})
+	h.AddCheck("llm.openai", func() (string, any) {
+		return "ok", nil
+	})
+
+	result, err := h.HandleHealth(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("HandleHealth: %v", err)
+	}
+	health := result.(HealthCheck)
+	if health.Status != "degraded" {
+		t.Errorf("expected status=degraded, got %s", health.Status)
+	}
+	if health.Checks["llm.ollama"] != "down" || health.Checks["llm.openai"] != "ok" {
+		t.Errorf("unexpected checks %v", health.Checks)
+	}
+	if _, ok := health.Details["llm.ollama"]; !ok {
+		t.Error("expected details for llm.ollama")
+	}
+	if _, ok := health.Details["llm.openai"]; ok {
+		t.Error("expected no details for llm.openai")
+	}
+}
+
+func TestStatusStats(t *testing.T) {
+	h := NewStatusHandler("1.0.0-test")
+	h.AddStats("llm_cache", func() any {
+		return map[string]int{"hits": 3, "misses": 1}
+	})
+
+	result, err := h.HandleStatus(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("HandleStatus: %v", err)
+	}
+	status := result.(DaemonStatus)
+	stats, ok := status.Stats["llm_cache"].(map[string]int)
+	if !ok || stats["hits"] != 3 {
+		t.Errorf("expected llm_cache stats, got %v", status.Stats)
+	}
+}
+
 func TestMultipleRequests(t *testing.T) {
 	sock := testSocket(t)
 	defer os.Remove(sock)
@@ -283,3 +328,70 @@ func TestMultipleRequests(t *testing.T) {
 		t.Fatalf("expected 3 calls, got %d", callCount)
 	}
 }
+
+func TestServerNotify(t *testing.T) {
+	sock := testSocket(t)
+	defer os.Remove(sock)
+
+	s := NewServer(sock)
+	s.Handle("test.stream", func(ctx context.Context, params json.RawMessage) (any, error) {
+		for _, delta := range []string{"a", "b"} {
+			if err := Notify(ctx, "stream.delta", map[string]string{"delta": delta}); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]string{"done": "ab"}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	data, _ := json.Marshal(Request{JSONRPC: "2.0", Method: "test.stream", ID: 7})
+	conn.Write(append(data, '\n'))
+
+	scanner := bufio.NewScanner(conn)
+	var deltas []string
+	for scanner.Scan() {
+		var msg struct {
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+			ID     any               `json:"id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if msg.Method == "" {
+			if msg.ID != float64(7) {
+				t.Fatalf("expected response id 7, got %v", msg.ID)
+			}
+			break
+		}
+		if msg.Method != "stream.delta" {
+			t.Fatalf("unexpected notification %q", msg.Method)
+		}
+		deltas = append(deltas, msg.Params["delta"])
+	}
+
+	if len(deltas) != 2 || deltas[0] != "a" || deltas[1] != "b" {
+		t.Fatalf("expected notifications a, b before response, got %v", deltas)
+	}
+}
+
+func TestNotifyWithoutConnection(t *testing.T) {
+	if err := Notify(context.Background(), "stream.delta", nil); err == nil {
+		t.Fatal("expected error without a connection in context")
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/user/bender/internal/logging"
+)
+
+// Config for the cache store
+type Config struct {
+	DBPath     string
+	TTL        time.Duration // how long an entry stays valid
+	MaxEntries int           // 0 means unlimited
+	MaxBytes   int64         // 0 means unlimited
+}
+
+// Stats reports cache effectiveness and size
+type Stats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Store is a key/value cache backed by SQLite with TTL expiry and
+// least-recently-used eviction once the size limits are exceeded.
+type Store struct {
+	db         *sql.DB
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int64
+	hits       atomic.Int64
+	misses     atomic.Int64
+}
+
+// NewStore opens the cache table in the given database, creating it if needed
+func NewStore(cfg Config) (*Store, error) {
+	if cfg.TTL == 0 {
+		cfg.TTL = 7 * 24 * time.Hour
+	}
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS llm_cache (
+			key TEXT PRIMARY KEY,
+			value BLOB NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			last_used_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_cache_expires ON llm_cache(expires_at);
+		CREATE INDEX IF NOT EXISTS idx_llm_cache_last_used ON llm_cache(last_used_at);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+
+	return &Store{
+		db:         db,
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   cfg.MaxBytes,
+	}, nil
+}
+
+// Get returns the value stored under key if it has not expired
+func (s *Store) Get(key string) ([]byte, bool) {
+	now := time.Now()
+	var value []byte
+	err := s.db.QueryRow(`SELECT value FROM llm_cache WHERE key = ? AND expires_at > ?`, key, now).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.Warn("cache lookup failed: %v", err)
+		}
+		s.misses.Add(1)
+		return nil, false
+	}
+
+	s.hits.Add(1)
+	if _, err := s.db.Exec(`UPDATE llm_cache SET last_used_at = ? WHERE key = ?`, now, key); err != nil {
+		logging.Debug("cache touch failed: %v", err)
+	}
+	return value, true
+}
+
+// Put stores value under key and evicts entries beyond the size limits
+func (s *Store) Put(key string, value []byte) error {
+	now := time.Now()
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO llm_cache (key, value, size, created_at, expires_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, key, value, len(value), now, now.Add(s.ttl), now)
+	if err != nil {
+		return fmt.Errorf("insert cache entry: %w", err)
+	}
+	return s.evict()
+}
+
+// evict drops expired entries, then the least recently used ones until the
+// store fits its entry and byte limits
+func (s *Store) evict() error {
+	if _, err := s.db.Exec(`DELETE FROM llm_cache WHERE expires_at <= ?`, time.Now()); err != nil {
+		return fmt.Errorf("delete expired: %w", err)
+	}
+
+	if s.maxEntries > 0 {
+		_, err := s.db.Exec(`
+			DELETE FROM llm_cache WHERE key IN (
+				SELECT key FROM llm_cache ORDER BY last_used_at DESC LIMIT -1 OFFSET ?
+			)
+		`, s.maxEntries)
+		if err != nil {
+			return fmt.Errorf("evict entries: %w", err)
+		}
+	}
+
+	if s.maxBytes > 0 {
+		// Keep the most recently used entries whose running size fits
+		_, err := s.db.Exec(`
+			DELETE FROM llm_cache WHERE key IN (
+				SELECT key FROM (
+					SELECT key, SUM(size) OVER (ORDER BY last_used_at DESC, key) AS running
+					FROM llm_cache
+				) WHERE running > ?
+			)
+		`, s.maxBytes)
+		if err != nil {
+			return fmt.Errorf("evict bytes: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stats returns hit/miss counters since start and the current size
+func (s *Store) Stats() Stats {
+	st := Stats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM llm_cache WHERE expires_at > ?`, time.Now()).
+		Scan(&st.Entries, &st.Bytes)
+	if err != nil {
+		logging.Debug("cache stats failed: %v", err)
+	}
+	return st
+}
+
+// Clear removes every entry
+func (s *Store) Clear() error {
+	_, err := s.db.Exec(`DELETE FROM llm_cache`)
+	return err
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, cfg Config) *Store {
+	t.Helper()
+	cfg.DBPath = filepath.Join(t.TempDir(), "test.db")
+	s, err := NewStore(cfg)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreGetPut(t *testing.T) {
+	s := newTestStore(t, Config{})
+
+	if _, ok := s.Get("k"); ok {
+		t.Fatal("expected miss on empty store")
+	}
+	if err := s.Put("k", []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	v, ok := s.Get("k")
+	if !ok || string(v) != "v" {
+		t.Fatalf("expected hit with v, got %q %v", v, ok)
+	}
+
+	st := s.Stats()
+	if st.Hits != 1 || st.Misses != 1 || st.Entries != 1 || st.Bytes != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	s := newTestStore(t, Config{TTL: 50 * time.Millisecond})
+
+	s.Put("k", []byte("v"))
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := s.Get("k"); ok {
+		t.Error("expected expired entry to miss")
+	}
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := newTestStore(t, Config{MaxEntries: 2})
+
+	s.Put("a", []byte("1"))
+	time.Sleep(5 * time.Millisecond)
+	s.Put("b", []byte("2"))
+	time.Sleep(5 * time.Millisecond)
+	s.Get("a") // a is now more recent than b
+	time.Sleep(5 * time.Millisecond)
+	s.Put("c", []byte("3"))
+
+	if _, ok := s.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Error("expected a to survive")
+	}
+	if _, ok := s.Get("c"); !ok {
+		t.Error("expected c to survive")
+	}
+}
+
+func TestStoreEvictsBySize(t *testing.T) {
+	s := newTestStore(t, Config{MaxBytes: 10})
+
+	s.Put("a", []byte(strings.Repeat("x", 6)))
+	time.Sleep(5 * time.Millisecond)
+	s.Put("b", []byte(strings.Repeat("y", 6)))
+
+	if _, ok := s.Get("a"); ok {
+		t.Error("expected a to be evicted to fit the byte limit")
+	}
+	if st := s.Stats(); st.Bytes > 10 {
+		t.Errorf("expected at most 10 bytes, got %d", st.Bytes)
+	}
+}
@@ -17,6 +17,7 @@ type Monitor struct {
 	onChange     func(content string)
 	lastContent  string
 	lastChange   int64
+	paused       bool
 	mu           sync.Mutex
 	ctx          context.Context
 	cancel       context.CancelFunc
@@ -64,6 +65,20 @@ func (m *Monitor) Stop() error {
 	return nil
 }
 
+// Pause stops the monitor from reporting clipboard changes
+func (m *Monitor) Pause() {
+	m.mu.Lock()
+	m.paused = true
+	m.mu.Unlock()
+}
+
+// Resume reports clipboard changes again after Pause
+func (m *Monitor) Resume() {
+	m.mu.Lock()
+	m.paused = false
+	m.mu.Unlock()
+}
+
 func (m *Monitor) pollLoop() {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
@@ -92,6 +107,13 @@ func (m *Monitor) checkClipboard() {
 		return
 	}
 
+	// While paused, track the content without acting on it, so nothing
+	// copied during the pause is picked up on resume
+	if m.paused {
+		m.lastContent = content
+		return
+	}
+
 	// Skip if content is too short
 	if len(content) < m.minLength {
 		m.lastContent = content
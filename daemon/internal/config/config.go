@@ -21,17 +21,78 @@ type Config struct {
 }
 
 type LLMConfig struct {
-	DefaultProvider string                     `yaml:"default_provider"`
-	Providers       map[string]*ProviderConfig `yaml:"providers"`
+	DefaultProvider   string                     `yaml:"default_provider"`
+	FallbackProviders []string                   `yaml:"fallback_providers"`
+	Providers         map[string]*ProviderConfig `yaml:"providers"`
+	Routing           map[string]*RouteConfig    `yaml:"routing"`
+	Pricing           map[string]PriceConfig     `yaml:"pricing"`
+	Health            HealthConfig               `yaml:"health"`
+	Cache             CacheConfig                `yaml:"cache"`
+}
+
+type CacheConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	TTLHours   int  `yaml:"ttl_hours"`
+	MaxEntries int  `yaml:"max_entries"`
+	MaxSizeMB  int  `yaml:"max_size_mb"`
+}
+
+// PriceConfig is a model's price in USD per million tokens. Keys in
+// LLMConfig.Pricing are model names, or "provider/model".
+type PriceConfig struct {
+	InputPerMTok  float64 `yaml:"input_per_mtok"`
+	OutputPerMTok float64 `yaml:"output_per_mtok"`
+}
+
+// RouteConfig overrides provider selection and sampling for one task type.
+// Zero values keep the handler's own defaults.
+type RouteConfig struct {
+	Provider    string   `yaml:"provider"`
+	Model       string   `yaml:"model"`
+	Temperature *float64 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens"`
+}
+
+type HealthConfig struct {
+	IntervalSeconds  int `yaml:"interval_seconds"`
+	FailureThreshold int `yaml:"failure_threshold"`
+	CooldownSeconds  int `yaml:"cooldown_seconds"`
 }
 
 type ProviderConfig struct {
-	Enabled        bool   `yaml:"enabled"`
-	BaseURL        string `yaml:"base_url"`
-	APIKey         string `yaml:"api_key"`
-	Model          string `yaml:"model"`
-	VisionModel    string `yaml:"vision_model"`
-	TimeoutSeconds int    `yaml:"timeout_seconds"`
+	Enabled        bool              `yaml:"enabled"`
+	Type           string            `yaml:"type"` // defaults to the provider name
+	BaseURL        string            `yaml:"base_url"`
+	APIKey         string            `yaml:"api_key"`
+	Headers        map[string]string `yaml:"headers"`
+	Model          string            `yaml:"model"`
+	VisionModel    string            `yaml:"vision_model"`
+	TimeoutSeconds int               `yaml:"timeout_seconds"`
+	Budget         BudgetConfig      `yaml:"budget"`
+	Limits         LimitsConfig      `yaml:"limits"`
+}
+
+// LimitsConfig caps how hard the daemon drives a provider. Zero values
+// are unlimited.
+type LimitsConfig struct {
+	MaxInFlight       int `yaml:"max_in_flight"`
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	TokensPerMinute   int `yaml:"tokens_per_minute"`
+}
+
+// BudgetConfig caps a provider's spend per calendar day and month. Zero
+// limits are unlimited; once any limit is reached the provider is skipped.
+type BudgetConfig struct {
+	DailyTokens   int     `yaml:"daily_tokens"`
+	MonthlyTokens int     `yaml:"monthly_tokens"`
+	DailyUSD      float64 `yaml:"daily_usd"`
+	MonthlyUSD    float64 `yaml:"monthly_usd"`
+	WarnPercent   int     `yaml:"warn_percent"`
+}
+
+// Enabled reports whether any limit is set
+func (b BudgetConfig) Enabled() bool {
+	return b.DailyTokens > 0 || b.MonthlyTokens > 0 || b.DailyUSD > 0 || b.MonthlyUSD > 0
 }
 
 type ClipboardConfig struct {
@@ -95,10 +156,39 @@ type ScreenshotsConfig struct {
 }
 
 type QueueConfig struct {
-	MaxConcurrent         int `yaml:"max_concurrent"`
-	DefaultTimeoutSeconds int `yaml:"default_timeout_seconds"`
-	MaxRetries            int `yaml:"max_retries"`
-	RetryDelaySeconds     int `yaml:"retry_delay_seconds"`
+	MaxConcurrent         int  `yaml:"max_concurrent"`
+	DefaultTimeoutSeconds int  `yaml:"default_timeout_seconds"`
+	MaxRetries            int  `yaml:"max_retries"`
+	RetryDelaySeconds     int  `yaml:"retry_delay_seconds"`
+	MaxRetryDelaySeconds  int  `yaml:"max_retry_delay_seconds"`
+	InteractiveWorkers    *int `yaml:"interactive_workers"`   // unset means 1
+	AgingSeconds          *int `yaml:"aging_seconds"`         // 0 disables aging; unset means 60
+	MaxPending            int  `yaml:"max_pending"`           // 0 means unbounded
+	DedupeWindowSeconds   *int `yaml:"dedupe_window_seconds"` // 0 disables the window; unset means 60
+	DrainTimeoutSeconds   *int `yaml:"drain_timeout_seconds"` // shutdown grace period; 0 interrupts at once, unset means 10
+
+	// Types overrides the settings above for particular task types
+	Types map[string]QueueTypeConfig `yaml:"types"`
+
+	Retention RetentionConfig `yaml:"retention"`
+}
+
+// QueueTypeConfig overrides queue settings for one task type; a timeout of
+// 0 or an unset max_retries uses the queue-wide value
+type QueueTypeConfig struct {
+	TimeoutSeconds int  `yaml:"timeout_seconds"`
+	MaxRetries     *int `yaml:"max_retries"`
+	Workers        int  `yaml:"workers"` // dedicated workers that run only this type
+}
+
+// RetentionConfig bounds the task history. Only finished tasks are pruned.
+type RetentionConfig struct {
+	MaxAgeDays       int            `yaml:"max_age_days"`        // 0 keeps tasks regardless of age
+	StatusMaxAgeDays map[string]int `yaml:"status_max_age_days"` // overrides max_age_days per final status
+	MaxRows          int            `yaml:"max_rows"`            // 0 means unlimited
+	ScrubAfterDays   int            `yaml:"scrub_after_days"`    // clear payloads and results; 0 never scrubs
+	ArchivePath      string         `yaml:"archive_path"`        // JSON lines file for pruned tasks
+	IntervalMinutes  int            `yaml:"interval_minutes"`
 }
 
 type LoggingConfig struct {
@@ -115,7 +205,7 @@ type NotificationsConfig struct {
 }
 
 func Load(path string) (*Config, error) {
-	path = expandPath(path)
+	path = ExpandPath(path)
 
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -138,6 +228,23 @@ func (c *Config) setDefaults() {
 	if c.LLM.DefaultProvider == "" {
 		c.LLM.DefaultProvider = "ollama"
 	}
+	if c.LLM.Health.IntervalSeconds == 0 {
+		c.LLM.Health.IntervalSeconds = 60
+	}
+	if c.LLM.Health.FailureThreshold == 0 {
+		c.LLM.Health.FailureThreshold = 3
+	}
+	if c.LLM.Health.CooldownSeconds == 0 {
+		c.LLM.Health.CooldownSeconds = 30
+	}
+	if c.LLM.Cache.TTLHours == 0 {
+		c.LLM.Cache.TTLHours = 168
+	}
+	for _, prov := range c.LLM.Providers {
+		if prov != nil && prov.Budget.WarnPercent == 0 {
+			prov.Budget.WarnPercent = 80
+		}
+	}
 	if c.Clipboard.MinLength == 0 {
 		c.Clipboard.MinLength = 500
 	}
@@ -153,6 +260,24 @@ func (c *Config) setDefaults() {
 	if c.Queue.MaxRetries == 0 {
 		c.Queue.MaxRetries = 3
 	}
+	if c.Queue.MaxRetryDelaySeconds == 0 {
+		c.Queue.MaxRetryDelaySeconds = 300
+	}
+	if c.Queue.InteractiveWorkers == nil {
+		c.Queue.InteractiveWorkers = intPtr(1)
+	}
+	if c.Queue.AgingSeconds == nil {
+		c.Queue.AgingSeconds = intPtr(60)
+	}
+	if c.Queue.DedupeWindowSeconds == nil {
+		c.Queue.DedupeWindowSeconds = intPtr(60)
+	}
+	if c.Queue.DrainTimeoutSeconds == nil {
+		c.Queue.DrainTimeoutSeconds = intPtr(10)
+	}
+	if c.Queue.Retention.IntervalMinutes == 0 {
+		c.Queue.Retention.IntervalMinutes = 60
+	}
 	if c.AutoFile.SettleDelayMs == 0 {
 		c.AutoFile.SettleDelayMs = 3000
 	}
@@ -170,16 +295,21 @@ func (c *Config) setDefaults() {
 	}
 }
 
+func intPtr(v int) *int {
+	return &v
+}
+
 func (c *Config) expandPaths() {
 	for i := range c.AutoFile.WatchDirs {
-		c.AutoFile.WatchDirs[i] = expandPath(c.AutoFile.WatchDirs[i])
+		c.AutoFile.WatchDirs[i] = ExpandPath(c.AutoFile.WatchDirs[i])
 	}
-	c.AutoFile.DestinationRoot = expandPath(c.AutoFile.DestinationRoot)
+	c.AutoFile.DestinationRoot = ExpandPath(c.AutoFile.DestinationRoot)
 	for i := range c.AutoFile.Categories {
-		c.AutoFile.Categories[i].Path = expandPath(c.AutoFile.Categories[i].Path)
+		c.AutoFile.Categories[i].Path = ExpandPath(c.AutoFile.Categories[i].Path)
 	}
-	c.Screenshots.WatchDir = expandPath(c.Screenshots.WatchDir)
-	c.Screenshots.Destination = expandPath(c.Screenshots.Destination)
+	c.Screenshots.WatchDir = ExpandPath(c.Screenshots.WatchDir)
+	c.Screenshots.Destination = ExpandPath(c.Screenshots.Destination)
+	c.Queue.Retention.ArchivePath = ExpandPath(c.Queue.Retention.ArchivePath)
 }
 
 func (c *Config) resolveSecrets() {
@@ -192,10 +322,16 @@ func (c *Config) resolveSecrets() {
 			// If resolve fails for a keychain: ref, leave the original value
 			// so the error surfaces when the provider tries to use it
 		}
+		for header, value := range prov.Headers {
+			if resolved, err := keychain.Resolve(value); err == nil {
+				prov.Headers[header] = resolved
+			}
+		}
 	}
 }
 
-func expandPath(path string) string {
+// ExpandPath replaces a leading ~ with the home directory
+func ExpandPath(path string) string {
 	if len(path) > 0 && path[0] == '~' {
 		home, err := os.UserHomeDir()
 		if err == nil {
@@ -51,6 +51,7 @@ type Watcher struct {
 	pollInterval    time.Duration
 	handler         Handler
 	known           map[string]time.Time
+	paused          bool
 	mu              sync.RWMutex
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -104,6 +105,28 @@ func (w *Watcher) Stop() error {
 	return nil
 }
 
+// Pause stops the watcher from scanning. Files that appear while it is
+// paused are reported once it resumes.
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	w.paused = true
+	w.mu.Unlock()
+}
+
+// Resume restarts scanning after Pause
+func (w *Watcher) Resume() {
+	w.mu.Lock()
+	w.paused = false
+	w.mu.Unlock()
+}
+
+// Paused reports whether the watcher is paused
+func (w *Watcher) Paused() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.paused
+}
+
 func (w *Watcher) pollLoop() {
 	ticker := time.NewTicker(w.pollInterval)
 	defer ticker.Stop()
@@ -113,6 +136,9 @@ func (w *Watcher) pollLoop() {
 		case <-w.ctx.Done():
 			return
 		case <-ticker.C:
+			if w.Paused() {
+				continue
+			}
 			for _, dir := range w.dirs {
 				w.scanDir(dir, false)
 			}
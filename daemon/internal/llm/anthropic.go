@@ -8,13 +8,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type AnthropicProvider struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey  string
+	model   string
+	timeout time.Duration
+	client  *http.Client
 }
 
 type AnthropicConfig struct {
@@ -33,11 +35,10 @@ func NewAnthropicProvider(cfg AnthropicConfig) *AnthropicProvider {
 	}
 
 	return &AnthropicProvider{
-		apiKey: cfg.APIKey,
-		model:  cfg.Model,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		apiKey:  cfg.APIKey,
+		model:   cfg.Model,
+		timeout: timeout,
+		client:  newHTTPClient(timeout),
 	}
 }
 
@@ -49,11 +50,69 @@ func (p *AnthropicProvider) SupportsVision() bool {
 	return true
 }
 
+// Ping checks reachability and credentials by listing models
+func (p *AnthropicProvider) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.anthropic.com/v1/models?limit=1", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return newProviderError(p.Name(), resp, string(bodyBytes))
+	}
+	return nil
+}
+
 type anthropicRequest struct {
 	Model     string             `json:"model"`
 	MaxTokens int                `json:"max_tokens"`
 	Messages  []anthropicMessage `json:"messages"`
 	System    string             `json:"system,omitempty"`
+	Stream    bool               `json:"stream,omitempty"`
+	// Tools and ToolChoice force a single tool call whose input is the
+	// structured response
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"` // "tool"
+	Name string `json:"name"`
+}
+
+// responseTool is the tool Anthropic is forced to call for structured output
+const responseTool = "respond"
+
+// withResponseSchema forces a tool call matching schema, if one is set
+func (r anthropicRequest) withResponseSchema(schema json.RawMessage) anthropicRequest {
+	if len(schema) == 0 {
+		return r
+	}
+	r.Tools = []anthropicTool{{
+		Name:        responseTool,
+		Description: "Return the response in the required structure",
+		InputSchema: schema,
+	}}
+	r.ToolChoice = &anthropicToolChoice{Type: "tool", Name: responseTool}
+	return r
 }
 
 type anthropicMessage struct {
@@ -62,8 +121,8 @@ type anthropicMessage struct {
 }
 
 type anthropicContent struct {
-	Type   string               `json:"type"`
-	Text   string               `json:"text,omitempty"`
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
 	Source *anthropicImageSource `json:"source,omitempty"`
 }
 
@@ -74,20 +133,55 @@ type anthropicImageSource struct {
 }
 
 type anthropicResponse struct {
-	ID           string `json:"id"`
-	Type         string `json:"type"`
-	Role         string `json:"role"`
-	Content      []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"` // tool_use arguments
 	} `json:"content"`
-	Model        string `json:"model"`
-	StopReason   string `json:"stop_reason"`
-	StopSequence string `json:"stop_sequence"`
-	Usage        struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
+	Model        string         `json:"model"`
+	StopReason   string         `json:"stop_reason"`
+	StopSequence string         `json:"stop_sequence"`
+	Usage        anthropicUsage `json:"usage"`
+	Error        *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) usage() Usage {
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// anthropicStreamEvent covers the fields used across the SSE event types
+// (message_start, content_block_delta, message_delta, error).
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	// Message is set on message_start and carries the input token count
+	Message struct {
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	// Usage is set on message_delta and carries the output token count
+	Usage anthropicUsage `json:"usage"`
 	Error *struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
@@ -95,6 +189,10 @@ type anthropicResponse struct {
 }
 
 func (p *AnthropicProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	return p.doRequest(ctx, p.messagesRequest(req))
+}
+
+func (p *AnthropicProvider) messagesRequest(req CompletionRequest) anthropicRequest {
 	model := req.Model
 	if model == "" {
 		model = p.model
@@ -118,14 +216,97 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req CompletionRequest)
 		})
 	}
 
-	anthropicReq := anthropicRequest{
+	return anthropicRequest{
 		Model:     model,
 		MaxTokens: maxTokens,
 		Messages:  messages,
 		System:    system,
+	}.withResponseSchema(req.ResponseSchema)
+}
+
+// Stream sends a messages request with streaming enabled and forwards each
+// text delta to onDelta.
+func (p *AnthropicProvider) Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	anthropicReq := p.messagesRequest(req)
+	anthropicReq.Stream = true
+
+	idle := newIdleTimeout(ctx, p.timeout)
+	defer idle.stop()
+
+	httpReq, err := p.newHTTPRequest(idle.ctx, anthropicReq)
+	if err != nil {
+		return nil, err
 	}
 
-	return p.doRequest(ctx, anthropicReq)
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", idle.err(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		var anthropicResp anthropicResponse
+		message := string(bodyBytes)
+		if json.Unmarshal(bodyBytes, &anthropicResp) == nil && anthropicResp.Error != nil {
+			message = anthropicResp.Error.Message
+		}
+		return nil, newProviderError(p.Name(), resp, message)
+	}
+
+	var content strings.Builder
+	var stopReason, model string
+	var usage anthropicUsage
+	err = readSSE(idle.reader(resp.Body), func(event, data string) error {
+		var ev anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("decode event: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			model = ev.Message.Model
+			usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				content.WriteString(ev.Delta.Text)
+				return onDelta(ev.Delta.Text)
+			}
+			// Structured output arrives as the forced tool call's arguments
+			if ev.Delta.Type == "input_json_delta" && ev.Delta.PartialJSON != "" {
+				content.WriteString(ev.Delta.PartialJSON)
+				return onDelta(ev.Delta.PartialJSON)
+			}
+		case "message_delta":
+			if ev.Delta.StopReason != "" {
+				stopReason = ev.Delta.StopReason
+			}
+			if ev.Usage.OutputTokens > 0 {
+				usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "error":
+			// Mid-stream errors (e.g. overloaded_error) are reported as 5xx
+			message := "stream error"
+			if ev.Error != nil {
+				message = ev.Error.Message
+			}
+			return &ProviderError{Provider: p.Name(), StatusCode: http.StatusServiceUnavailable, Message: message}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, idle.err(err)
+	}
+
+	if content.Len() == 0 {
+		return nil, ErrNoContent
+	}
+
+	return &CompletionResponse{
+		Content:      content.String(),
+		FinishReason: stopReason,
+		Usage:        usage.usage(),
+		Model:        model,
+	}, nil
 }
 
 func (p *AnthropicProvider) CompleteWithVision(ctx context.Context, req VisionRequest) (*CompletionResponse, error) {
@@ -184,12 +365,12 @@ func (p *AnthropicProvider) CompleteWithVision(ctx context.Context, req VisionRe
 		MaxTokens: maxTokens,
 		Messages:  messages,
 		System:    system,
-	}
+	}.withResponseSchema(req.ResponseSchema)
 
 	return p.doRequest(ctx, anthropicReq)
 }
 
-func (p *AnthropicProvider) doRequest(ctx context.Context, req anthropicRequest) (*CompletionResponse, error) {
+func (p *AnthropicProvider) newHTTPRequest(ctx context.Context, req anthropicRequest) (*http.Request, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -202,6 +383,17 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, req anthropicRequest)
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", p.apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	return httpReq, nil
+}
+
+func (p *AnthropicProvider) doRequest(ctx context.Context, req anthropicRequest) (*CompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := p.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
@@ -209,14 +401,21 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, req anthropicRequest)
 	}
 	defer resp.Body.Close()
 
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
 	var anthropicResp anthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(bodyBytes, &anthropicResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, newProviderError(p.Name(), resp, string(bodyBytes))
+		}
 		return nil, fmt.Errorf("decode response (status %d): %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	if anthropicResp.Error != nil {
-		return nil, fmt.Errorf("anthropic error: %s", anthropicResp.Error.Message)
+		return nil, newProviderError(p.Name(), resp, anthropicResp.Error.Message)
 	}
 
 	if len(anthropicResp.Content) == 0 {
@@ -225,18 +424,24 @@ func (p *AnthropicProvider) doRequest(ctx context.Context, req anthropicRequest)
 
 	var content string
 	for _, c := range anthropicResp.Content {
-		if c.Type == "text" {
+		switch {
+		case c.Type == "text":
 			content += c.Text
+		case c.Type == "tool_use" && c.Name == responseTool:
+			// Structured output: the tool input is the response document
+			return &CompletionResponse{
+				Content:      string(c.Input),
+				FinishReason: anthropicResp.StopReason,
+				Usage:        anthropicResp.Usage.usage(),
+				Model:        anthropicResp.Model,
+			}, nil
 		}
 	}
 
 	return &CompletionResponse{
 		Content:      content,
 		FinishReason: anthropicResp.StopReason,
-		Usage: Usage{
-			PromptTokens:     anthropicResp.Usage.InputTokens,
-			CompletionTokens: anthropicResp.Usage.OutputTokens,
-			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
-		},
+		Usage:        anthropicResp.Usage.usage(),
+		Model:        anthropicResp.Model,
 	}, nil
 }
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/bender/internal/config"
+	"github.com/user/bender/internal/logging"
+)
+
+// ErrBudgetExceeded is returned when a provider has used up its budget
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Spend is a provider's consumption in the current calendar day and month
+type Spend struct {
+	DayTokens   int
+	DayUSD      float64
+	MonthTokens int
+	MonthUSD    float64
+}
+
+// SpendFunc returns how much a provider has consumed so far
+type SpendFunc func(provider string) (Spend, error)
+
+// BudgetWarning is emitted once per period when a provider crosses its
+// warning threshold, and again when it reaches the limit
+type BudgetWarning struct {
+	Provider string  `json:"provider"`
+	Period   string  `json:"period"` // "daily" or "monthly"
+	Unit     string  `json:"unit"`   // "tokens" or "usd"
+	Used     float64 `json:"used"`
+	Limit    float64 `json:"limit"`
+	Percent  float64 `json:"percent"`
+	Exceeded bool    `json:"exceeded"`
+}
+
+// budgetGate enforces per-provider budgets against a spend source
+type budgetGate struct {
+	mu      sync.Mutex
+	limits  map[string]config.BudgetConfig
+	spend   SpendFunc
+	onWarn  []func(BudgetWarning)
+	emitted map[string]string // provider/period/unit/level -> period key
+}
+
+func newBudgetGate() *budgetGate {
+	return &budgetGate{
+		limits:  make(map[string]config.BudgetConfig),
+		emitted: make(map[string]string),
+	}
+}
+
+// SetSpendSource sets where provider budgets read their current spend
+// from. Budgets are not enforced until a source is set.
+func (r *Router) SetSpendSource(fn SpendFunc) {
+	r.budgets.mu.Lock()
+	defer r.budgets.mu.Unlock()
+	r.budgets.spend = fn
+}
+
+// OnBudgetWarning registers fn to be called when a provider nears or
+// reaches one of its budget limits
+func (r *Router) OnBudgetWarning(fn func(BudgetWarning)) {
+	r.budgets.mu.Lock()
+	defer r.budgets.mu.Unlock()
+	r.budgets.onWarn = append(r.budgets.onWarn, fn)
+}
+
+// check returns ErrBudgetExceeded when provider has reached any of its
+// limits. Spend lookups that fail are logged and let the request through.
+func (g *budgetGate) check(provider string) error {
+	g.mu.Lock()
+	limits, ok := g.limits[provider]
+	spend := g.spend
+	g.mu.Unlock()
+	if !ok || spend == nil {
+		return nil
+	}
+
+	s, err := spend(provider)
+	if err != nil {
+		logging.Warn("budget check for %s failed: %v", provider, err)
+		return nil
+	}
+
+	now := time.Now()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	checks := []struct {
+		period, key, unit string
+		used, limit       float64
+	}{
+		{"daily", day, "tokens", float64(s.DayTokens), float64(limits.DailyTokens)},
+		{"daily", day, "usd", s.DayUSD, limits.DailyUSD},
+		{"monthly", month, "tokens", float64(s.MonthTokens), float64(limits.MonthlyTokens)},
+		{"monthly", month, "usd", s.MonthUSD, limits.MonthlyUSD},
+	}
+
+	var exceeded error
+	for _, c := range checks {
+		if c.limit <= 0 {
+			continue
+		}
+		percent := c.used / c.limit * 100
+		w := BudgetWarning{
+			Provider: provider,
+			Period:   c.period,
+			Unit:     c.unit,
+			Used:     c.used,
+			Limit:    c.limit,
+			Percent:  percent,
+		}
+		switch {
+		case percent >= 100:
+			w.Exceeded = true
+			g.warn(w, c.key)
+			if exceeded == nil {
+				exceeded = fmt.Errorf("%w: %s %s limit of %g reached", ErrBudgetExceeded, c.period, c.unit, c.limit)
+			}
+		case percent >= float64(limits.WarnPercent) && limits.WarnPercent > 0:
+			g.warn(w, c.key)
+		}
+	}
+	return exceeded
+}
+
+// warn emits w unless it was already emitted for the same period
+func (g *budgetGate) warn(w BudgetWarning, periodKey string) {
+	level := "warn"
+	if w.Exceeded {
+		level = "exceeded"
+	}
+	id := w.Provider + "/" + w.Period + "/" + w.Unit + "/" + level
+
+	g.mu.Lock()
+	if g.emitted[id] == periodKey {
+		g.mu.Unlock()
+		return
+	}
+	g.emitted[id] = periodKey
+	hooks := g.onWarn
+	g.mu.Unlock()
+
+	if w.Exceeded {
+		logging.Warn("provider %s reached its %s %s budget (%g of %g), skipping it", w.Provider, w.Period, w.Unit, w.Used, w.Limit)
+	} else {
+		logging.Warn("provider %s at %.0f%% of its %s %s budget", w.Provider, w.Percent, w.Period, w.Unit)
+	}
+	for _, fn := range hooks {
+		fn(w)
+	}
+}
@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/user/bender/internal/logging"
+)
+
+// Cache stores serialized completion responses by key
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, value []byte) error
+}
+
+// SetCache puts c in front of Complete, CompleteWithVision and Stream.
+// Requests with NoCache set skip the lookup but still refresh the entry.
+func (r *Router) SetCache(c Cache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = c
+}
+
+// cacheKey hashes everything that determines a completion: the provider and
+// model the request is routed to, the messages, the images and sampling
+// parameters. model is the routed model and falls back to req.Model.
+func cacheKey(provider, model string, req CompletionRequest, images []Image) string {
+	if model == "" {
+		model = req.Model
+	}
+	type imageKey struct {
+		MimeType string
+		URL      string
+		Hash     []byte
+	}
+	key := struct {
+		Provider    string
+		Model       string
+		Messages    []Message
+		Images      []imageKey
+		Temperature float64
+		MaxTokens   int
+		Schema      json.RawMessage
+	}{
+		Provider:    provider,
+		Model:       model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Schema:      req.ResponseSchema,
+	}
+	for _, img := range images {
+		sum := sha256.Sum256(img.Data)
+		key.Images = append(key.Images, imageKey{MimeType: img.MimeType, URL: img.URL, Hash: sum[:]})
+	}
+
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cached returns the stored response for key, or nil on a miss or when the
+// request opts out of the cache
+func (r *Router) cached(key string, req CompletionRequest) *CompletionResponse {
+	r.mu.RLock()
+	c := r.cache
+	r.mu.RUnlock()
+	if c == nil || req.NoCache {
+		return nil
+	}
+
+	data, ok := c.Get(key)
+	if !ok {
+		return nil
+	}
+	var resp CompletionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		logging.Warn("discarding unreadable cache entry: %v", err)
+		return nil
+	}
+	resp.Cached = true
+	logging.Debug("cache hit for %s", resp.Provider)
+	return &resp
+}
+
+// store saves resp under key, which was built for target. An answer from a
+// fallback provider is not saved: the key would claim it came from target,
+// and later requests should go back to target once it recovers.
+func (r *Router) store(key, target string, resp *CompletionResponse) {
+	r.mu.RLock()
+	c := r.cache
+	r.mu.RUnlock()
+	if c == nil || resp.Provider != target {
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := c.Put(key, data); err != nil {
+		logging.Warn("failed to cache response: %v", err)
+	}
+}
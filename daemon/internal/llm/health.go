@@ -0,0 +1,203 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/user/bender/internal/logging"
+)
+
+// BreakerState is the state of a provider's circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// Pinger is implemented by providers that offer a cheap health check
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ProviderHealth is a snapshot of a provider's breaker and probe results
+type ProviderHealth struct {
+	Name                string       `json:"name"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LatencyMs           int64        `json:"latency_ms"`
+	CheckedAt           *time.Time   `json:"checked_at,omitempty"`
+}
+
+// breaker is a consecutive-failure circuit breaker. It opens after threshold
+// failures in a row and lets a trial request through once cooldown has passed.
+type breaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	lastErr   string
+	latency   time.Duration
+	checkedAt time.Time
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// allow reports whether a request may be sent, moving an open breaker to
+// half-open once the cooldown has elapsed.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+	}
+	return b.state != BreakerOpen
+}
+
+func (b *breaker) success(latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.lastErr = ""
+	b.latency = latency
+	b.checkedAt = time.Now()
+}
+
+func (b *breaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastErr = err.Error()
+	b.checkedAt = time.Now()
+
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			logging.Warn("circuit for %s opened after %d consecutive failures: %v", b.name, b.failures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *breaker) snapshot() ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := ProviderHealth{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+		LatencyMs:           b.latency.Milliseconds(),
+	}
+	if !b.checkedAt.IsZero() {
+		checkedAt := b.checkedAt
+		h.CheckedAt = &checkedAt
+	}
+	return h
+}
+
+// record feeds the outcome of a real request into the breaker. Only
+// transient failures count against it; a bad request says nothing about the
+// provider's availability.
+func (b *breaker) record(start time.Time, err error) {
+	switch {
+	case err == nil:
+		b.success(time.Since(start))
+	case IsRetryable(err):
+		b.failure(err)
+	}
+}
+
+// StartHealthChecks probes every provider that implements Pinger once
+// immediately and then every interval until ctx is done. Probe results feed
+// the same breakers as real traffic, so a recovered provider closes its
+// breaker without waiting for a user request.
+func (r *Router) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			r.probeAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *Router) probeAll(ctx context.Context) {
+	r.mu.RLock()
+	pingers := make(map[string]Pinger, len(r.providers))
+	for name, p := range r.providers {
+		if pinger, ok := p.(Pinger); ok {
+			pingers[name] = pinger
+		}
+	}
+	r.mu.RUnlock()
+
+	for name, pinger := range pingers {
+		r.mu.RLock()
+		b := r.breakers[name]
+		r.mu.RUnlock()
+
+		probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		start := time.Now()
+		err := pinger.Ping(probeCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.Debug("health probe for %s failed: %v", name, err)
+			b.failure(err)
+			continue
+		}
+		b.success(time.Since(start))
+	}
+}
+
+// Health returns the breaker state of every provider, sorted by name
+func (r *Router) Health() []ProviderHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	health := make([]ProviderHealth, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		health = append(health, b.snapshot())
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+	return health
+}
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/user/bender/internal/config"
+)
+
+// tokenBucket refills at rate per second up to capacity. Takes larger than
+// the capacity are clamped so a single oversized request can still proceed.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64
+	last     time.Time
+}
+
+// newPerMinuteBucket returns a full bucket allowing perMinute units per
+// minute, or nil when perMinute is not positive
+func newPerMinuteBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// wait blocks until n units are available and takes them
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	if b == nil {
+		return nil
+	}
+	if n > b.capacity {
+		n = b.capacity
+	}
+
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		if b.tokens >= n {
+			b.tokens -= n
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// adjust corrects an earlier take once the real cost is known. The balance
+// may go negative, delaying later requests.
+func (b *tokenBucket) adjust(delta float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.tokens -= delta
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// limiter enforces a provider's concurrency and rate limits and the
+// cool-down requested by its last Retry-After header. A nil limiter allows
+// everything.
+type limiter struct {
+	name     string
+	inflight chan struct{}
+	requests *tokenBucket
+	tokens   *tokenBucket
+
+	mu         sync.Mutex
+	blockedFor time.Time
+}
+
+func newLimiter(name string, cfg config.LimitsConfig) *limiter {
+	if cfg.MaxInFlight <= 0 && cfg.RequestsPerMinute <= 0 && cfg.TokensPerMinute <= 0 {
+		return nil
+	}
+	l := &limiter{
+		name:     name,
+		requests: newPerMinuteBucket(cfg.RequestsPerMinute),
+		tokens:   newPerMinuteBucket(cfg.TokensPerMinute),
+	}
+	if cfg.MaxInFlight > 0 {
+		l.inflight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return l
+}
+
+// acquire waits for a slot and rate budget for req. It fails fast with a
+// 429 ProviderError while the provider is cooling down after a Retry-After,
+// so the router can move on to the next provider. The returned release
+// function must be called with the outcome of the request.
+func (l *limiter) acquire(ctx context.Context, req CompletionRequest) (func(*CompletionResponse, error), error) {
+	if l == nil {
+		return func(*CompletionResponse, error) {}, nil
+	}
+
+	l.mu.Lock()
+	wait := time.Until(l.blockedFor)
+	l.mu.Unlock()
+	if wait > 0 {
+		return nil, &ProviderError{
+			Provider:   l.name,
+			StatusCode: http.StatusTooManyRequests,
+			Message:    "rate limited, waiting for Retry-After",
+			RetryAfter: wait,
+		}
+	}
+
+	if l.inflight != nil {
+		select {
+		case l.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.inflight != nil {
+			<-l.inflight
+		}
+	}
+
+	if err := l.requests.wait(ctx, 1); err != nil {
+		release()
+		return nil, err
+	}
+	estimate := estimateTokens(req)
+	if err := l.tokens.wait(ctx, float64(estimate)); err != nil {
+		release()
+		return nil, err
+	}
+
+	return func(resp *CompletionResponse, err error) {
+		release()
+		if resp != nil && resp.Usage.TotalTokens > 0 {
+			l.tokens.adjust(float64(resp.Usage.TotalTokens - estimate))
+		}
+		var provErr *ProviderError
+		if errors.As(err, &provErr) && provErr.StatusCode == http.StatusTooManyRequests && provErr.RetryAfter > 0 {
+			l.mu.Lock()
+			l.blockedFor = time.Now().Add(provErr.RetryAfter)
+			l.mu.Unlock()
+		}
+	}, nil
+}
+
+// estimateTokens guesses a request's token cost before it is sent, at
+// roughly four characters per token plus the completion budget
+func estimateTokens(req CompletionRequest) int {
+	chars := 0
+	for _, m := range req.Messages {
+		chars += len(m.Content)
+	}
+	completion := req.MaxTokens
+	if completion == 0 {
+		completion = 256
+	}
+	return chars/4 + completion
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/user/bender/internal/config"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"20", 20 * time.Second},
+		{"1.5", 1500 * time.Millisecond},
+		{"-1", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucketWaits(t *testing.T) {
+	b := newPerMinuteBucket(600) // 10 per second
+	ctx := context.Background()
+
+	if err := b.wait(ctx, 600); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	start := time.Now()
+	if err := b.wait(ctx, 2); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected to wait for refill, waited %v", elapsed)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := b.wait(cctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// slowProvider tracks how many calls run at the same time
+type slowProvider struct {
+	fakeProvider
+	running, peak atomic.Int32
+}
+
+func (s *slowProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return &CompletionResponse{Content: "ok"}, nil
+}
+
+func TestMaxInFlight(t *testing.T) {
+	p := &slowProvider{fakeProvider: fakeProvider{name: "openai"}}
+	r := newTestRouter("openai", nil)
+	r.addProvider("openai", p)
+	r.limiters = map[string]*limiter{"openai": newLimiter("openai", config.LimitsConfig{MaxInFlight: 2})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Complete(context.Background(), CompletionRequest{}); err != nil {
+				t.Errorf("Complete: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := p.peak.Load(); peak > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", peak)
+	}
+}
+
+func TestRetryAfterSkipsProvider(t *testing.T) {
+	openai := &fakeProvider{name: "openai", err: &ProviderError{Provider: "openai", StatusCode: 429, RetryAfter: time.Minute}}
+	ollama := &fakeProvider{name: "ollama"}
+	r := newTestRouter("openai", []string{"ollama"}, openai, ollama)
+	r.limiters = map[string]*limiter{"openai": newLimiter("openai", config.LimitsConfig{RequestsPerMinute: 100})}
+
+	for i := 0; i < 2; i++ {
+		resp, err := r.Complete(context.Background(), CompletionRequest{})
+		if err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if resp.Provider != "ollama" {
+			t.Errorf("expected fallback to ollama, got %s", resp.Provider)
+		}
+	}
+	if openai.calls != 1 {
+		t.Errorf("expected openai to be skipped while cooling down, got %d calls", openai.calls)
+	}
+
+	// Without a fallback the cool-down surfaces with its retry hint
+	r.fallbackProviders = nil
+	_, err := r.Complete(context.Background(), CompletionRequest{})
+	if d := RetryAfter(err); d <= 0 || d > time.Minute {
+		t.Errorf("expected retry hint up to a minute, got %v (%v)", d, err)
+	}
+}
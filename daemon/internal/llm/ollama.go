@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type OllamaProvider struct {
 	baseURL string
 	model   string
+	timeout time.Duration
 	client  *http.Client
 }
 
@@ -38,9 +40,8 @@ func NewOllamaProvider(cfg OllamaConfig) *OllamaProvider {
 	return &OllamaProvider{
 		baseURL: cfg.BaseURL,
 		model:   cfg.Model,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		timeout: timeout,
+		client:  newHTTPClient(timeout),
 	}
 }
 
@@ -53,10 +54,34 @@ func (p *OllamaProvider) SupportsVision() bool {
 	return true
 }
 
+// Ping checks that the Ollama server is reachable by listing local models
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return newProviderError(p.Name(), resp, string(bodyBytes))
+	}
+	return nil
+}
+
 type ollamaRequest struct {
 	Model    string          `json:"model"`
 	Messages []ollamaMessage `json:"messages"`
 	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"` // JSON schema for structured output
 	Options  *ollamaOptions  `json:"options,omitempty"`
 }
 
@@ -72,13 +97,29 @@ type ollamaOptions struct {
 }
 
 type ollamaResponse struct {
-	Model     string        `json:"model"`
-	CreatedAt string        `json:"created_at"`
-	Message   ollamaMessage `json:"message"`
-	Done      bool          `json:"done"`
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// usage converts Ollama's eval counters, which are only set on the final
+// (done) message, into token usage
+func (r *ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
 }
 
 func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	return p.doRequest(ctx, p.chatRequest(req, false))
+}
+
+func (p *OllamaProvider) chatRequest(req CompletionRequest, stream bool) ollamaRequest {
 	model := req.Model
 	if model == "" {
 		model = p.model
@@ -95,7 +136,8 @@ func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (*
 	ollamaReq := ollamaRequest{
 		Model:    model,
 		Messages: messages,
-		Stream:   false,
+		Stream:   stream,
+		Format:   req.ResponseSchema,
 	}
 
 	if req.Temperature > 0 || req.MaxTokens > 0 {
@@ -105,7 +147,7 @@ func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (*
 		}
 	}
 
-	return p.doRequest(ctx, ollamaReq)
+	return ollamaReq
 }
 
 func (p *OllamaProvider) CompleteWithVision(ctx context.Context, req VisionRequest) (*CompletionResponse, error) {
@@ -137,6 +179,7 @@ func (p *OllamaProvider) CompleteWithVision(ctx context.Context, req VisionReque
 		Model:    model,
 		Messages: messages,
 		Stream:   false,
+		Format:   req.ResponseSchema,
 	}
 
 	if req.Temperature > 0 || req.MaxTokens > 0 {
@@ -149,7 +192,55 @@ func (p *OllamaProvider) CompleteWithVision(ctx context.Context, req VisionReque
 	return p.doRequest(ctx, ollamaReq)
 }
 
-func (p *OllamaProvider) doRequest(ctx context.Context, req ollamaRequest) (*CompletionResponse, error) {
+// Stream sends a chat request with streaming enabled and forwards each
+// NDJSON chunk to onDelta.
+func (p *OllamaProvider) Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	idle := newIdleTimeout(ctx, p.timeout)
+	defer idle.stop()
+
+	resp, err := p.post(idle.ctx, p.chatRequest(req, true))
+	if err != nil {
+		return nil, idle.err(err)
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var final ollamaResponse
+	err = readLines(idle.reader(resp.Body), func(line string) error {
+		var chunk ollamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return fmt.Errorf("decode chunk: %w", err)
+		}
+		if chunk.Done {
+			final = chunk
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, idle.err(err)
+	}
+
+	if content.Len() == 0 {
+		return nil, ErrNoContent
+	}
+
+	return &CompletionResponse{
+		Content:      content.String(),
+		FinishReason: "stop",
+		Usage:        final.usage(),
+		Model:        final.Model,
+	}, nil
+}
+
+// post sends req to the chat endpoint and returns the response once a
+// successful status has been received. The caller must close the body.
+func (p *OllamaProvider) post(ctx context.Context, req ollamaRequest) (*http.Response, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -165,12 +256,25 @@ func (p *OllamaProvider) doRequest(ctx context.Context, req ollamaRequest) (*Com
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		resp.Body.Close()
+		return nil, newProviderError(p.Name(), resp, string(bodyBytes))
+	}
+
+	return resp, nil
+}
+
+func (p *OllamaProvider) doRequest(ctx context.Context, req ollamaRequest) (*CompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
 	var ollamaResp ollamaResponse
 	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
@@ -184,5 +288,7 @@ func (p *OllamaProvider) doRequest(ctx context.Context, req ollamaRequest) (*Com
 	return &CompletionResponse{
 		Content:      ollamaResp.Message.Content,
 		FinishReason: "stop",
+		Usage:        ollamaResp.usage(),
+		Model:        ollamaResp.Model,
 	}, nil
 }
@@ -8,29 +8,49 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider speaks the OpenAI chat completions wire format. Besides
+// OpenAI itself it serves any compatible server (LM Studio, vLLM, llama.cpp)
+// configured with its own base URL.
 type OpenAIProvider struct {
+	name        string
+	baseURL     string
 	apiKey      string
+	headers     map[string]string
 	model       string
 	visionModel string
+	timeout     time.Duration
 	client      *http.Client
 }
 
 type OpenAIConfig struct {
-	APIKey         string
+	Name           string            // defaults to "openai"
+	BaseURL        string            // defaults to the OpenAI API
+	APIKey         string            // optional for local servers
+	Headers        map[string]string // extra headers sent with every request
 	Model          string
 	VisionModel    string
 	TimeoutSeconds int
 }
 
 func NewOpenAIProvider(cfg OpenAIConfig) *OpenAIProvider {
-	if cfg.Model == "" {
-		cfg.Model = "gpt-4o-mini"
+	if cfg.Name == "" {
+		cfg.Name = "openai"
 	}
-	if cfg.VisionModel == "" {
-		cfg.VisionModel = "gpt-4o"
+	if cfg.BaseURL == "" {
+		// Model defaults only make sense against the real OpenAI API
+		cfg.BaseURL = defaultOpenAIBaseURL
+		if cfg.Model == "" {
+			cfg.Model = "gpt-4o-mini"
+		}
+		if cfg.VisionModel == "" {
+			cfg.VisionModel = "gpt-4o"
+		}
 	}
 	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
 	if timeout == 0 {
@@ -38,21 +58,59 @@ func NewOpenAIProvider(cfg OpenAIConfig) *OpenAIProvider {
 	}
 
 	return &OpenAIProvider{
+		name:        cfg.Name,
+		baseURL:     strings.TrimRight(cfg.BaseURL, "/"),
 		apiKey:      cfg.APIKey,
+		headers:     cfg.Headers,
 		model:       cfg.Model,
 		visionModel: cfg.VisionModel,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		timeout:     timeout,
+		client:      newHTTPClient(timeout),
 	}
 }
 
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
 }
 
+// SupportsVision reports whether a vision model is configured. OpenAI always
+// has one; compatible servers only when vision_model is set.
 func (p *OpenAIProvider) SupportsVision() bool {
-	return true
+	return p.visionModel != ""
+}
+
+// setHeaders applies auth and any configured extra headers
+func (p *OpenAIProvider) setHeaders(httpReq *http.Request) {
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	for k, v := range p.headers {
+		httpReq.Header.Set(k, v)
+	}
+}
+
+// Ping checks reachability and credentials by listing models
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	p.setHeaders(httpReq)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return newProviderError(p.Name(), resp, string(bodyBytes))
+	}
+	return nil
 }
 
 type openaiRequest struct {
@@ -60,6 +118,49 @@ type openaiRequest struct {
 	Messages    []openaiMessage `json:"messages"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature float64         `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	// StreamOptions asks for a final chunk carrying token usage
+	StreamOptions  *openaiStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *openaiResponseFormat `json:"response_format,omitempty"`
+}
+
+type openaiResponseFormat struct {
+	Type       string            `json:"type"` // "json_schema"
+	JSONSchema *openaiJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openaiJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// responseFormat maps a response schema to OpenAI structured outputs
+func responseFormat(schema json.RawMessage) *openaiResponseFormat {
+	if len(schema) == 0 {
+		return nil
+	}
+	return &openaiResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: &openaiJSONSchema{Name: "response", Schema: schema},
+	}
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openaiUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u openaiUsage) usage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
 }
 
 type openaiMessage struct {
@@ -88,19 +189,48 @@ type openaiResponse struct {
 		Message      openaiMessage `json:"message"`
 		FinishReason string        `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage openaiUsage `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 		Code    string `json:"code"`
 	} `json:"error"`
+	// Message is set instead of Error by servers such as vLLM, which
+	// answer {"object":"error","message":...}
+	Message string `json:"message"`
+}
+
+// errorMessage returns the error reported in an unsuccessful response,
+// falling back to the raw body
+func (r *openaiResponse) errorMessage(body []byte) string {
+	switch {
+	case r.Error != nil && r.Error.Message != "":
+		return r.Error.Message
+	case r.Message != "":
+		return r.Message
+	}
+	return string(body)
+}
+
+type openaiStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openaiUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
 }
 
 func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	return p.doRequest(ctx, p.chatRequest(req))
+}
+
+func (p *OpenAIProvider) chatRequest(req CompletionRequest) openaiRequest {
 	model := req.Model
 	if model == "" {
 		model = p.model
@@ -114,14 +244,89 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (*
 		}
 	}
 
-	openaiReq := openaiRequest{
-		Model:       model,
-		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+	return openaiRequest{
+		Model:          model,
+		Messages:       messages,
+		MaxTokens:      req.MaxTokens,
+		Temperature:    req.Temperature,
+		ResponseFormat: responseFormat(req.ResponseSchema),
 	}
+}
 
-	return p.doRequest(ctx, openaiReq)
+// Stream sends a chat request with streaming enabled and forwards each SSE
+// delta to onDelta.
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	openaiReq := p.chatRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
+
+	idle := newIdleTimeout(ctx, p.timeout)
+	defer idle.stop()
+
+	httpReq, err := p.newHTTPRequest(idle.ctx, openaiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", idle.err(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		var openaiResp openaiResponse
+		json.Unmarshal(bodyBytes, &openaiResp)
+		return nil, newProviderError(p.Name(), resp, openaiResp.errorMessage(bodyBytes))
+	}
+
+	var content strings.Builder
+	var finishReason, model string
+	var usage Usage
+	err = readSSE(idle.reader(resp.Body), func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openaiStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return newProviderError(p.Name(), resp, chunk.Error.Message)
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			content.WriteString(delta)
+			return onDelta(delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, idle.err(err)
+	}
+
+	if content.Len() == 0 {
+		return nil, ErrNoContent
+	}
+
+	return &CompletionResponse{
+		Content:      content.String(),
+		FinishReason: finishReason,
+		Usage:        usage,
+		Model:        model,
+	}, nil
 }
 
 func (p *OpenAIProvider) CompleteWithVision(ctx context.Context, req VisionRequest) (*CompletionResponse, error) {
@@ -168,27 +373,39 @@ func (p *OpenAIProvider) CompleteWithVision(ctx context.Context, req VisionReque
 	}
 
 	openaiReq := openaiRequest{
-		Model:       model,
-		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+		Model:          model,
+		Messages:       messages,
+		MaxTokens:      req.MaxTokens,
+		Temperature:    req.Temperature,
+		ResponseFormat: responseFormat(req.ResponseSchema),
 	}
 
 	return p.doRequest(ctx, openaiReq)
 }
 
-func (p *OpenAIProvider) doRequest(ctx context.Context, req openaiRequest) (*CompletionResponse, error) {
+func (p *OpenAIProvider) newHTTPRequest(ctx context.Context, req openaiRequest) (*http.Request, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setHeaders(httpReq)
+	return httpReq, nil
+}
+
+func (p *OpenAIProvider) doRequest(ctx context.Context, req openaiRequest) (*CompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	httpReq, err := p.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
@@ -196,14 +413,22 @@ func (p *OpenAIProvider) doRequest(ctx context.Context, req openaiRequest) (*Com
 	}
 	defer resp.Body.Close()
 
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
 	var openaiResp openaiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("decode response (status %d): %s", resp.StatusCode, string(bodyBytes))
+	decodeErr := json.Unmarshal(bodyBytes, &openaiResp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderError(p.Name(), resp, openaiResp.errorMessage(bodyBytes))
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decode response: %s", string(bodyBytes))
 	}
 
 	if openaiResp.Error != nil {
-		return nil, fmt.Errorf("openai error: %s", openaiResp.Error.Message)
+		return nil, newProviderError(p.Name(), resp, openaiResp.Error.Message)
 	}
 
 	if len(openaiResp.Choices) == 0 {
@@ -218,10 +443,7 @@ func (p *OpenAIProvider) doRequest(ctx context.Context, req openaiRequest) (*Com
 	return &CompletionResponse{
 		Content:      content,
 		FinishReason: openaiResp.Choices[0].FinishReason,
-		Usage: Usage{
-			PromptTokens:     openaiResp.Usage.PromptTokens,
-			CompletionTokens: openaiResp.Usage.CompletionTokens,
-			TotalTokens:      openaiResp.Usage.TotalTokens,
-		},
+		Usage:        openaiResp.Usage.usage(),
+		Model:        openaiResp.Model,
 	}, nil
 }
@@ -2,14 +2,22 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	ErrProviderNotFound  = errors.New("provider not found")
-	ErrProviderDisabled  = errors.New("provider is disabled")
-	ErrVisionNotSupport  = errors.New("provider does not support vision")
-	ErrNoContent         = errors.New("no content in response")
+	ErrProviderNotFound = errors.New("provider not found")
+	ErrProviderDisabled = errors.New("provider is disabled")
+	ErrVisionNotSupport = errors.New("provider does not support vision")
+	ErrNoContent        = errors.New("no content in response")
+	ErrCircuitOpen      = errors.New("no provider available: circuit open")
 )
 
 // Provider is the interface for LLM providers
@@ -17,15 +25,26 @@ type Provider interface {
 	Name() string
 	Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
 	CompleteWithVision(ctx context.Context, req VisionRequest) (*CompletionResponse, error)
+	Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error)
 	SupportsVision() bool
 }
 
+// StreamFunc receives each chunk of generated text as it arrives. Returning
+// an error aborts the stream.
+type StreamFunc func(delta string) error
+
 // CompletionRequest represents a text completion request
 type CompletionRequest struct {
 	Model       string
 	Messages    []Message
 	Temperature float64
 	MaxTokens   int
+	Route       string // routing key, usually the task type (e.g. "git.commit")
+	NoCache     bool   // skip the response cache lookup
+	// ResponseSchema is a JSON schema the response must match. When set,
+	// providers are asked for structured output and Content holds the JSON
+	// document.
+	ResponseSchema json.RawMessage
 }
 
 // Message represents a chat message
@@ -52,6 +71,9 @@ type CompletionResponse struct {
 	Content      string
 	FinishReason string
 	Usage        Usage
+	Provider     string // name of the provider that answered
+	Model        string // model that produced the response
+	Cached       bool   // served from the response cache
 }
 
 // Usage tracks token usage
@@ -60,3 +82,82 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 }
+
+// ProviderError is returned when a provider answers with a non-success status
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s error (status %d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// RetryDelay exposes the Retry-After hint to callers that only know the
+// method, such as the task queue
+func (e *ProviderError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// newProviderError builds a ProviderError from an HTTP response
+func newProviderError(provider string, resp *http.Response, message string) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter reads a Retry-After value given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// RetryAfter returns how long the provider asked callers to wait before
+// retrying, if err carries such a hint
+func RetryAfter(err error) time.Duration {
+	var provErr *ProviderError
+	if errors.As(err, &provErr) {
+		return provErr.RetryAfter
+	}
+	return 0
+}
+
+// IsRetryable reports whether err is a transient failure that another
+// provider may not share: connection errors, timeouts, 5xx and 429 responses.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var provErr *ProviderError
+	if errors.As(err, &provErr) {
+		return provErr.StatusCode == http.StatusTooManyRequests || provErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// Transport failures (refused connections, DNS, client timeouts) surface
+	// as *url.Error, which implements net.Error
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,36 @@
+package llm
+
+// applyRoute applies the routing rule configured for req.Route, overriding
+// temperature and max tokens in place. It returns the provider the rule
+// targets and the model to use on that provider; both are empty when no rule
+// matches or the rule leaves them unset.
+func (r *Router) applyRoute(req *CompletionRequest) (provider, model string) {
+	if req.Route == "" {
+		return "", ""
+	}
+
+	r.mu.RLock()
+	rt, ok := r.routes[req.Route]
+	r.mu.RUnlock()
+	if !ok {
+		return "", ""
+	}
+
+	if rt.Temperature != nil {
+		req.Temperature = *rt.Temperature
+	}
+	if rt.MaxTokens > 0 {
+		req.MaxTokens = rt.MaxTokens
+	}
+	return rt.Provider, rt.Model
+}
+
+// withRouteModel sets the routed model on req when it is sent to the route's
+// target provider. Model names are provider-specific, so fallbacks keep
+// their own configured model.
+func withRouteModel(req CompletionRequest, name, target, model string) CompletionRequest {
+	if model != "" && name == target {
+		req.Model = model
+	}
+	return req
+}
@@ -3,24 +3,46 @@ package llm
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/user/bender/internal/config"
+	"github.com/user/bender/internal/logging"
 )
 
 // Router manages multiple LLM providers and routes requests
 type Router struct {
-	providers       map[string]Provider
-	defaultProvider string
-	visionProvider  string
-	mu              sync.RWMutex
+	providers         map[string]Provider
+	breakers          map[string]*breaker
+	limiters          map[string]*limiter
+	routes            map[string]config.RouteConfig
+	usageHooks        []UsageFunc
+	budgets           *budgetGate
+	cache             Cache
+	defaultProvider   string
+	fallbackProviders []string
+	// localProviders run on this machine and cost nothing; requests turned
+	// away by a budget go to them when the chain has no other provider
+	localProviders   []string
+	visionProvider   string
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	mu               sync.RWMutex
 }
 
 // NewRouter creates a new provider router from config
 func NewRouter(cfg *config.LLMConfig) (*Router, error) {
 	r := &Router{
-		providers:       make(map[string]Provider),
-		defaultProvider: cfg.DefaultProvider,
+		providers:         make(map[string]Provider),
+		breakers:          make(map[string]*breaker),
+		limiters:          make(map[string]*limiter),
+		routes:            make(map[string]config.RouteConfig),
+		budgets:           newBudgetGate(),
+		defaultProvider:   cfg.DefaultProvider,
+		fallbackProviders: cfg.FallbackProviders,
+		breakerThreshold:  cfg.Health.FailureThreshold,
+		breakerCooldown:   time.Duration(cfg.Health.CooldownSeconds) * time.Second,
 	}
 
 	for name, provCfg := range cfg.Providers {
@@ -28,8 +50,15 @@ func NewRouter(cfg *config.LLMConfig) (*Router, error) {
 			continue
 		}
 
+		// The provider type defaults to its name, so the built-in
+		// "ollama", "openai" and "anthropic" entries need no type field
+		kind := provCfg.Type
+		if kind == "" {
+			kind = name
+		}
+
 		var provider Provider
-		switch name {
+		switch kind {
 		case "ollama":
 			provider = NewOllamaProvider(OllamaConfig{
 				BaseURL:        provCfg.BaseURL,
@@ -38,7 +67,23 @@ func NewRouter(cfg *config.LLMConfig) (*Router, error) {
 			})
 		case "openai":
 			provider = NewOpenAIProvider(OpenAIConfig{
+				Name:           name,
+				APIKey:         provCfg.APIKey,
+				Headers:        provCfg.Headers,
+				Model:          provCfg.Model,
+				VisionModel:    provCfg.VisionModel,
+				TimeoutSeconds: provCfg.TimeoutSeconds,
+			})
+		case "openai_compatible":
+			if provCfg.BaseURL == "" {
+				logging.Warn("provider %s: openai_compatible requires base_url, skipping", name)
+				continue
+			}
+			provider = NewOpenAIProvider(OpenAIConfig{
+				Name:           name,
+				BaseURL:        provCfg.BaseURL,
 				APIKey:         provCfg.APIKey,
+				Headers:        provCfg.Headers,
 				Model:          provCfg.Model,
 				VisionModel:    provCfg.VisionModel,
 				TimeoutSeconds: provCfg.TimeoutSeconds,
@@ -50,15 +95,24 @@ func NewRouter(cfg *config.LLMConfig) (*Router, error) {
 				TimeoutSeconds: provCfg.TimeoutSeconds,
 			})
 		default:
+			logging.Warn("provider %s: unknown type %q, skipping", name, kind)
 			continue
 		}
 
-		r.providers[name] = provider
+		r.addProvider(name, provider)
+		if kind == "ollama" {
+			r.localProviders = append(r.localProviders, name)
+		}
+		r.limiters[name] = newLimiter(name, provCfg.Limits)
+		if provCfg.Budget.Enabled() {
+			r.budgets.limits[name] = provCfg.Budget
+		}
 	}
 
 	if len(r.providers) == 0 {
 		return nil, fmt.Errorf("no providers enabled")
 	}
+	sort.Strings(r.localProviders)
 
 	if _, ok := r.providers[r.defaultProvider]; !ok {
 		// Fall back to first available provider
@@ -68,9 +122,27 @@ func NewRouter(cfg *config.LLMConfig) (*Router, error) {
 		}
 	}
 
+	for key, rt := range cfg.Routing {
+		if rt == nil {
+			continue
+		}
+		if _, ok := r.providers[rt.Provider]; rt.Provider != "" && !ok {
+			logging.Warn("routing rule %s: provider %s is not enabled, using default", key, rt.Provider)
+		}
+		r.routes[key] = *rt
+	}
+
 	return r, nil
 }
 
+// addProvider registers a provider under name along with its circuit breaker
+func (r *Router) addProvider(name string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+	r.breakers[name] = newBreaker(name, r.breakerThreshold, r.breakerCooldown)
+}
+
 // GetProvider returns a specific provider by name
 func (r *Router) GetProvider(name string) (Provider, error) {
 	r.mu.RLock()
@@ -90,47 +162,231 @@ func (r *Router) GetProvider(name string) (Provider, error) {
 
 // GetVisionProvider returns a vision-capable provider
 func (r *Router) GetVisionProvider(preferred string) (Provider, error) {
+	names := r.visionChain(preferred)
+	if len(names) == 0 {
+		return nil, ErrVisionNotSupport
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.providers[names[0]], nil
+}
 
-	// Try preferred first
-	if preferred != "" {
-		if p, ok := r.providers[preferred]; ok && p.SupportsVision() {
-			return p, nil
+// chain returns the ordered provider names to try for a request: the first
+// choice followed by the configured fallbacks, skipping unknown or duplicate
+// entries.
+func (r *Router) chain(first string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if first == "" {
+		first = r.defaultProvider
+	}
+
+	candidates := append([]string{first}, r.fallbackProviders...)
+	names := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, name := range candidates {
+		if _, ok := r.providers[name]; !ok || seen[name] {
+			continue
 		}
+		seen[name] = true
+		names = append(names, name)
 	}
+	return names
+}
 
-	// Try default
-	if p, ok := r.providers[r.defaultProvider]; ok && p.SupportsVision() {
-		return p, nil
+// withLocal returns names followed by the local providers it lacks, so a
+// request over a paid provider's budget still has somewhere to go
+func (r *Router) withLocal(names []string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := names
+	for _, local := range r.localProviders {
+		found := false
+		for _, name := range names {
+			if name == local {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out[:len(out):len(out)], local)
+		}
 	}
+	return out
+}
 
-	// Find any vision provider
-	for _, p := range r.providers {
-		if p.SupportsVision() {
-			return p, nil
+// BudgetFallbacks returns the providers that take requests for provider
+// once its budget is used up: its fallbacks, then the local providers
+func (r *Router) BudgetFallbacks(provider string) []string {
+	names := r.withLocal(r.chain(provider))
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != provider {
+			out = append(out, name)
 		}
 	}
+	return out
+}
 
-	return nil, ErrVisionNotSupport
+// visionChain returns the ordered vision-capable provider names to try:
+// the preferred provider, the default, the fallbacks, then any other
+// vision-capable provider.
+func (r *Router) visionChain(preferred string) []string {
+	names := r.chain(preferred)
+	if preferred != "" {
+		names = append(names, r.chain("")...)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	others := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	vision := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] || !r.providers[name].SupportsVision() {
+			continue
+		}
+		seen[name] = true
+		vision = append(vision, name)
+	}
+	return vision
 }
 
-// Complete sends a completion request to the default provider
+// Complete sends a completion request to the default provider, moving down
+// the fallback chain on transient failures
 func (r *Router) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
-	provider, err := r.GetProvider("")
+	target, model := r.applyRoute(&req)
+	if target == "" {
+		target = r.DefaultProviderName()
+	}
+
+	names := r.chain(target)
+	if len(names) == 0 {
+		return nil, ErrProviderNotFound
+	}
+
+	key := cacheKey(target, model, req, nil)
+	if resp := r.cached(key, req); resp != nil {
+		return resp, nil
+	}
+
+	resp, err := structured(req, func(req CompletionRequest) (*CompletionResponse, error) {
+		return r.failover(ctx, req, names, func(name string, p Provider) (*CompletionResponse, error) {
+			return p.Complete(ctx, withRouteModel(req, name, target, model))
+		}, IsRetryable)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return provider.Complete(ctx, req)
+	r.store(key, target, resp)
+	return resp, nil
 }
 
-// CompleteWithVision sends a vision request to a vision-capable provider
+// CompleteWithVision sends a vision request to a vision-capable provider,
+// moving down the fallback chain on transient failures. A routing rule for
+// req.Route takes precedence over preferredProvider.
 func (r *Router) CompleteWithVision(ctx context.Context, req VisionRequest, preferredProvider string) (*CompletionResponse, error) {
-	provider, err := r.GetVisionProvider(preferredProvider)
+	target, model := r.applyRoute(&req.CompletionRequest)
+	if target == "" {
+		target = preferredProvider
+	}
+
+	names := r.visionChain(target)
+	if len(names) == 0 {
+		return nil, ErrVisionNotSupport
+	}
+	if target == "" {
+		target = names[0]
+	}
+
+	key := cacheKey(target, model, req.CompletionRequest, req.Images)
+	if resp := r.cached(key, req.CompletionRequest); resp != nil {
+		return resp, nil
+	}
+
+	resp, err := structured(req.CompletionRequest, func(creq CompletionRequest) (*CompletionResponse, error) {
+		return r.failover(ctx, creq, names, func(name string, p Provider) (*CompletionResponse, error) {
+			routed := req
+			routed.CompletionRequest = withRouteModel(creq, name, target, model)
+			return p.CompleteWithVision(ctx, routed)
+		}, IsRetryable)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return provider.CompleteWithVision(ctx, req)
+	r.store(key, target, resp)
+	return resp, nil
+}
+
+// failover calls each named provider in turn until one succeeds, skipping
+// providers whose circuit breaker is open, whose budget is used up or that
+// asked to be left alone via Retry-After. Skipping one for its budget adds
+// the local providers to the end of the chain. Per-provider rate limits are
+// waited out before each call. It stops early when retryable
+// rejects an error or when ctx itself is done. req is only used for
+// bookkeeping; call is responsible for sending it.
+func (r *Router) failover(ctx context.Context, req CompletionRequest, names []string, call func(name string, p Provider) (*CompletionResponse, error), retryable func(error) bool) (*CompletionResponse, error) {
+	var lastErr error = ErrCircuitOpen
+	tried := 0
+	for i := 0; i < len(names); i++ {
+		name := names[i]
+		r.mu.RLock()
+		provider := r.providers[name]
+		b := r.breakers[name]
+		lim := r.limiters[name]
+		r.mu.RUnlock()
+
+		if !b.allow() {
+			logging.Debug("skipping provider %s: circuit open", name)
+			continue
+		}
+		if err := r.budgets.check(name); err != nil {
+			lastErr = fmt.Errorf("%s: %w", name, err)
+			names = r.withLocal(names)
+			continue
+		}
+
+		release, err := lim.acquire(ctx, req)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", name, err)
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+			logging.Debug("skipping provider %s: %v", name, err)
+			continue
+		}
+
+		start := time.Now()
+		resp, err := call(name, provider)
+		release(resp, err)
+		b.record(start, err)
+		tried++
+		if err == nil {
+			resp.Provider = name
+			if tried > 1 || name != names[0] {
+				logging.Info("request served by fallback provider %s", name)
+			}
+			r.reportUsage(ctx, req, resp)
+			return resp, nil
+		}
+
+		lastErr = fmt.Errorf("%s: %w", name, err)
+		if ctx.Err() != nil || !retryable(err) {
+			return nil, lastErr
+		}
+		logging.Warn("provider %s failed, trying next: %v", name, err)
+	}
+	return nil, lastErr
 }
 
 // ListProviders returns the names of all enabled providers
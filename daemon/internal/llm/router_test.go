@@ -0,0 +1,604 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/bender/internal/config"
+)
+
+// fakeProvider is a scripted Provider for router tests.
+type fakeProvider struct {
+	name   string
+	vision bool
+	err    error
+	calls  int
+	last   CompletionRequest
+}
+
+func (f *fakeProvider) Name() string         { return f.name }
+func (f *fakeProvider) SupportsVision() bool { return f.vision }
+
+func (f *fakeProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	f.calls++
+	f.last = req
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &CompletionResponse{Content: "from " + f.name, FinishReason: "stop"}, nil
+}
+
+func (f *fakeProvider) CompleteWithVision(ctx context.Context, req VisionRequest) (*CompletionResponse, error) {
+	return f.Complete(ctx, req.CompletionRequest)
+}
+
+func (f *fakeProvider) Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	resp, err := f.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.Fields(resp.Content) {
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func newTestRouter(def string, fallbacks []string, providers ...*fakeProvider) *Router {
+	r := &Router{
+		providers:         make(map[string]Provider),
+		breakers:          make(map[string]*breaker),
+		routes:            make(map[string]config.RouteConfig),
+		budgets:           newBudgetGate(),
+		defaultProvider:   def,
+		fallbackProviders: fallbacks,
+	}
+	for _, p := range providers {
+		r.addProvider(p.name, p)
+	}
+	return r
+}
+
+func TestCompleteUsesDefaultProvider(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama"}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "ollama" {
+		t.Errorf("expected provider ollama, got %s", resp.Provider)
+	}
+	if openai.calls != 0 {
+		t.Errorf("fallback should not be called, got %d calls", openai.calls)
+	}
+}
+
+func TestCompleteFailsOverOnRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"connection error", fmt.Errorf("do request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})},
+		{"server error", &ProviderError{Provider: "ollama", StatusCode: 503, Message: "unavailable"}},
+		{"rate limited", &ProviderError{Provider: "ollama", StatusCode: 429, Message: "slow down"}},
+		{"timeout", fmt.Errorf("do request: %w", context.DeadlineExceeded)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ollama := &fakeProvider{name: "ollama", err: tt.err}
+			openai := &fakeProvider{name: "openai"}
+			r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+			resp, err := r.Complete(context.Background(), CompletionRequest{})
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if resp.Provider != "openai" {
+				t.Errorf("expected provider openai, got %s", resp.Provider)
+			}
+		})
+	}
+}
+
+func TestCompleteStopsOnPermanentError(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 400, Message: "bad request"}}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	if _, err := r.Complete(context.Background(), CompletionRequest{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if openai.calls != 0 {
+		t.Errorf("fallback should not be called for a 400, got %d calls", openai.calls)
+	}
+}
+
+func TestCompleteSkipsUnknownFallbacks(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 500}}
+	anthropic := &fakeProvider{name: "anthropic"}
+	r := newTestRouter("ollama", []string{"openai", "ollama", "anthropic"}, ollama, anthropic)
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "anthropic" {
+		t.Errorf("expected provider anthropic, got %s", resp.Provider)
+	}
+	if ollama.calls != 1 {
+		t.Errorf("expected ollama to be tried once, got %d", ollama.calls)
+	}
+}
+
+func TestCompleteAllProvidersFail(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 502}}
+	openai := &fakeProvider{name: "openai", err: &ProviderError{Provider: "openai", StatusCode: 503}}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	_, err := r.Complete(context.Background(), CompletionRequest{})
+	var provErr *ProviderError
+	if !errors.As(err, &provErr) || provErr.StatusCode != 503 {
+		t.Fatalf("expected last provider error, got %v", err)
+	}
+}
+
+func TestCompleteWithVisionPrefersRequestedProvider(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", vision: true}
+	openai := &fakeProvider{name: "openai", vision: true, err: &ProviderError{Provider: "openai", StatusCode: 500}}
+	r := newTestRouter("ollama", nil, ollama, openai)
+
+	resp, err := r.CompleteWithVision(context.Background(), VisionRequest{}, "openai")
+	if err != nil {
+		t.Fatalf("CompleteWithVision: %v", err)
+	}
+	if openai.calls != 1 {
+		t.Errorf("expected preferred provider to be tried first")
+	}
+	if resp.Provider != "ollama" {
+		t.Errorf("expected provider ollama, got %s", resp.Provider)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if IsRetryable(nil) {
+		t.Error("nil should not be retryable")
+	}
+	if IsRetryable(ErrNoContent) {
+		t.Error("ErrNoContent should not be retryable")
+	}
+	if IsRetryable(context.Canceled) {
+		t.Error("context.Canceled should not be retryable")
+	}
+	if !IsRetryable(&ProviderError{StatusCode: 429}) {
+		t.Error("429 should be retryable")
+	}
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 503}}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.Complete(context.Background(), CompletionRequest{}); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+	}
+
+	// Default threshold is 3: after that ollama is skipped entirely
+	if ollama.calls != 3 {
+		t.Errorf("expected 3 calls before the breaker opened, got %d", ollama.calls)
+	}
+
+	health := r.Health()
+	if len(health) != 2 || health[0].Name != "ollama" {
+		t.Fatalf("unexpected health %+v", health)
+	}
+	if health[0].State != BreakerOpen {
+		t.Errorf("expected ollama breaker open, got %s", health[0].State)
+	}
+	if health[0].LastError == "" {
+		t.Error("expected last error to be recorded")
+	}
+	if health[1].State != BreakerClosed {
+		t.Errorf("expected openai breaker closed, got %s", health[1].State)
+	}
+}
+
+func TestBreakerIgnoresPermanentErrors(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 400}}
+	r := newTestRouter("ollama", nil, ollama)
+
+	for i := 0; i < 5; i++ {
+		r.Complete(context.Background(), CompletionRequest{})
+	}
+	if ollama.calls != 5 {
+		t.Errorf("400s should not open the breaker, got %d calls", ollama.calls)
+	}
+}
+
+func TestBreakerHalfOpenAfterCooldown(t *testing.T) {
+	b := newBreaker("ollama", 1, time.Millisecond)
+	b.failure(errors.New("boom"))
+	if b.allow() {
+		t.Fatal("breaker should be open right after failing")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker should let a trial request through after cooldown")
+	}
+	if b.snapshot().State != BreakerHalfOpen {
+		t.Errorf("expected half-open, got %s", b.snapshot().State)
+	}
+
+	b.success(time.Millisecond)
+	if b.snapshot().State != BreakerClosed {
+		t.Errorf("expected closed after success, got %s", b.snapshot().State)
+	}
+}
+
+func TestCompleteAllCircuitsOpen(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama"}
+	r := newTestRouter("ollama", nil, ollama)
+	r.breakers["ollama"].failure(errors.New("down"))
+	r.breakers["ollama"].failure(errors.New("down"))
+	r.breakers["ollama"].failure(errors.New("down"))
+
+	if _, err := r.Complete(context.Background(), CompletionRequest{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if ollama.calls != 0 {
+		t.Errorf("expected no calls while open, got %d", ollama.calls)
+	}
+}
+
+func TestNewRouterOpenAICompatible(t *testing.T) {
+	var gotPath, gotAuth, gotHeader, gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Team")
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		gotModel = body.Model
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	r, err := NewRouter(&config.LLMConfig{
+		DefaultProvider: "lmstudio",
+		Providers: map[string]*config.ProviderConfig{
+			"lmstudio": {
+				Enabled: true,
+				Type:    "openai_compatible",
+				BaseURL: srv.URL + "/v1/",
+				Headers: map[string]string{"X-Team": "bender"},
+				Model:   "qwen2.5-7b-instruct",
+			},
+			"broken": {Enabled: true, Type: "openai_compatible"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	if names := r.ListProviders(); len(names) != 1 || names[0] != "lmstudio" {
+		t.Fatalf("expected only lmstudio to be registered, got %v", names)
+	}
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{Messages: []Message{{Role: "user", Content: "hello"}}})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "lmstudio" || resp.Content != "hi" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Errorf("expected /v1/chat/completions, got %s", gotPath)
+	}
+	if gotAuth != "" {
+		t.Errorf("expected no Authorization header without api_key, got %q", gotAuth)
+	}
+	if gotHeader != "bender" {
+		t.Errorf("expected custom header, got %q", gotHeader)
+	}
+	if gotModel != "qwen2.5-7b-instruct" {
+		t.Errorf("expected configured model, got %q", gotModel)
+	}
+
+	p, _ := r.GetProvider("lmstudio")
+	if p.SupportsVision() {
+		t.Error("compatible provider without vision_model should not claim vision support")
+	}
+}
+
+func TestCompleteFailsOverOnCompatibleServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"object":"error","message":"model is loading","type":"ServiceUnavailable","code":503}`)
+	}))
+	defer srv.Close()
+
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("vllm", []string{"openai"}, openai)
+	vllm := NewOpenAIProvider(OpenAIConfig{Name: "vllm", BaseURL: srv.URL, Model: "qwen"})
+	r.addProvider("vllm", vllm)
+
+	_, err := vllm.Complete(context.Background(), CompletionRequest{})
+	var provErr *ProviderError
+	if !errors.As(err, &provErr) || provErr.Message != "model is loading" || provErr.RetryAfter != 30*time.Second {
+		t.Fatalf("expected a provider error with the server's message and Retry-After, got %v", err)
+	}
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "openai" {
+		t.Errorf("expected failover to openai, got %s", resp.Provider)
+	}
+}
+
+func TestRouteOverridesProviderAndSampling(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama"}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", nil, ollama, openai)
+	temp := 0.0
+	r.routes["git.commit"] = config.RouteConfig{Provider: "openai", Model: "gpt-4o", Temperature: &temp, MaxTokens: 512}
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{Route: "git.commit", Temperature: 0.3, MaxTokens: 256})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "openai" {
+		t.Errorf("expected provider openai, got %s", resp.Provider)
+	}
+	if openai.last.Model != "gpt-4o" || openai.last.Temperature != 0 || openai.last.MaxTokens != 512 {
+		t.Errorf("route overrides not applied: %+v", openai.last)
+	}
+
+	// Requests without a matching rule keep the default provider and settings
+	if _, err := r.Complete(context.Background(), CompletionRequest{Route: "file.rename", MaxTokens: 64}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if ollama.calls != 1 || ollama.last.MaxTokens != 64 {
+		t.Errorf("unrouted request changed: calls=%d req=%+v", ollama.calls, ollama.last)
+	}
+}
+
+func TestRouteModelNotSentToFallback(t *testing.T) {
+	openai := &fakeProvider{name: "openai", err: &ProviderError{Provider: "openai", StatusCode: 503, Message: "unavailable"}}
+	ollama := &fakeProvider{name: "ollama"}
+	r := newTestRouter("ollama", []string{"ollama"}, ollama, openai)
+	r.routes["git.commit"] = config.RouteConfig{Provider: "openai", Model: "gpt-4o", MaxTokens: 512}
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{Route: "git.commit"})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "ollama" {
+		t.Fatalf("expected fallback to ollama, got %s", resp.Provider)
+	}
+	if ollama.last.Model != "" {
+		t.Errorf("fallback received routed model %q", ollama.last.Model)
+	}
+	if ollama.last.MaxTokens != 512 {
+		t.Errorf("expected route max_tokens on fallback, got %d", ollama.last.MaxTokens)
+	}
+}
+
+func TestRouteOverridesVisionProvider(t *testing.T) {
+	openai := &fakeProvider{name: "openai", vision: true}
+	anthropic := &fakeProvider{name: "anthropic", vision: true}
+	r := newTestRouter("openai", nil, openai, anthropic)
+	r.routes["screenshot.tag"] = config.RouteConfig{Provider: "anthropic"}
+
+	resp, err := r.CompleteWithVision(context.Background(), VisionRequest{
+		CompletionRequest: CompletionRequest{Route: "screenshot.tag"},
+	}, "openai")
+	if err != nil {
+		t.Fatalf("CompleteWithVision: %v", err)
+	}
+	if resp.Provider != "anthropic" {
+		t.Errorf("expected routed provider anthropic, got %s", resp.Provider)
+	}
+}
+
+func TestOnUsageReportsServingProvider(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 503}}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	var events []UsageEvent
+	r.OnUsage(func(ctx context.Context, ev UsageEvent) {
+		events = append(events, ev)
+	})
+
+	if _, err := r.Complete(context.Background(), CompletionRequest{Route: "git.commit", Model: "m"}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 usage event, got %d", len(events))
+	}
+	if events[0].Provider != "openai" || events[0].Route != "git.commit" || events[0].Model != "m" {
+		t.Errorf("unexpected usage event: %+v", events[0])
+	}
+}
+
+func TestBudgetExceededReroutes(t *testing.T) {
+	openai := &fakeProvider{name: "openai"}
+	ollama := &fakeProvider{name: "ollama"}
+	r := newTestRouter("openai", []string{"ollama"}, openai, ollama)
+	r.budgets.limits["openai"] = config.BudgetConfig{DailyUSD: 1, MonthlyTokens: 1000, WarnPercent: 80}
+
+	spend := Spend{DayUSD: 0.85, MonthTokens: 100}
+	r.SetSpendSource(func(provider string) (Spend, error) { return spend, nil })
+	var warnings []BudgetWarning
+	r.OnBudgetWarning(func(w BudgetWarning) { warnings = append(warnings, w) })
+
+	// 85% of the daily limit: still served, warned once
+	for i := 0; i < 2; i++ {
+		resp, err := r.Complete(context.Background(), CompletionRequest{})
+		if err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if resp.Provider != "openai" {
+			t.Fatalf("expected openai under budget, got %s", resp.Provider)
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Exceeded || warnings[0].Unit != "usd" {
+		t.Fatalf("expected one usd warning, got %+v", warnings)
+	}
+
+	// Over the monthly token limit: rerouted to the fallback
+	spend.MonthTokens = 1000
+	resp, err := r.Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "ollama" {
+		t.Errorf("expected reroute to ollama, got %s", resp.Provider)
+	}
+	if len(warnings) != 2 || !warnings[1].Exceeded || warnings[1].Period != "monthly" {
+		t.Errorf("expected monthly exceeded warning, got %+v", warnings)
+	}
+}
+
+func TestBudgetExceededWithoutFallback(t *testing.T) {
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("openai", nil, openai)
+	r.budgets.limits["openai"] = config.BudgetConfig{DailyTokens: 10}
+	r.SetSpendSource(func(provider string) (Spend, error) { return Spend{DayTokens: 10}, nil })
+
+	_, err := r.Complete(context.Background(), CompletionRequest{})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if openai.calls != 0 {
+		t.Errorf("over-budget provider was called %d times", openai.calls)
+	}
+	if got := r.BudgetFallbacks("openai"); len(got) != 0 {
+		t.Errorf("expected nothing to take over, got %v", got)
+	}
+}
+
+func TestBudgetExceededReroutesToLocal(t *testing.T) {
+	openai := &fakeProvider{name: "openai"}
+	ollama := &fakeProvider{name: "ollama"}
+	// No fallbacks configured, as in the default config
+	r := newTestRouter("openai", nil, openai, ollama)
+	r.localProviders = []string{"ollama"}
+	r.budgets.limits["openai"] = config.BudgetConfig{DailyTokens: 10}
+	r.SetSpendSource(func(provider string) (Spend, error) { return Spend{DayTokens: 10}, nil })
+
+	if got := r.BudgetFallbacks("openai"); len(got) != 1 || got[0] != "ollama" {
+		t.Errorf("expected ollama to take over, got %v", got)
+	}
+	resp, err := r.Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Provider != "ollama" || openai.calls != 0 {
+		t.Errorf("expected reroute to ollama, got %s after %d openai calls", resp.Provider, openai.calls)
+	}
+
+	// A local provider is not added for other kinds of failure
+	openai.err = &ProviderError{Provider: "openai", StatusCode: 503, Message: "unavailable"}
+	r.budgets.limits = map[string]config.BudgetConfig{}
+	if _, err := r.Complete(context.Background(), CompletionRequest{}); err == nil {
+		t.Error("expected the outage to fail without fallbacks")
+	}
+}
+
+type memCache map[string][]byte
+
+func (m memCache) Get(key string) ([]byte, bool)  { v, ok := m[key]; return v, ok }
+func (m memCache) Put(key string, v []byte) error { m[key] = v; return nil }
+
+func TestCacheServesRepeatedRequests(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama"}
+	r := newTestRouter("ollama", nil, ollama)
+	r.SetCache(memCache{})
+
+	req := CompletionRequest{Messages: []Message{{Role: "user", Content: "hello"}}, MaxTokens: 64}
+	first, err := r.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	second, err := r.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if ollama.calls != 1 {
+		t.Errorf("expected 1 provider call, got %d", ollama.calls)
+	}
+	if first.Cached || !second.Cached || second.Content != first.Content {
+		t.Errorf("expected second response from cache: %+v", second)
+	}
+
+	// Any change to the request is a different key
+	req.MaxTokens = 128
+	r.Complete(context.Background(), req)
+	if ollama.calls != 2 {
+		t.Errorf("expected changed request to miss, got %d calls", ollama.calls)
+	}
+
+	// NoCache bypasses the lookup
+	req.NoCache = true
+	resp, _ := r.Complete(context.Background(), req)
+	if ollama.calls != 3 || resp.Cached {
+		t.Errorf("expected NoCache to reach the provider, got %d calls", ollama.calls)
+	}
+}
+
+func TestCacheSkipsFallbackAnswers(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 503, Message: "unavailable"}}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+	r.SetCache(memCache{})
+
+	req := CompletionRequest{Messages: []Message{{Role: "user", Content: "hello"}}}
+	if resp, _ := r.Complete(context.Background(), req); resp == nil || resp.Provider != "openai" {
+		t.Fatalf("expected the fallback to answer, got %+v", resp)
+	}
+
+	// Once the default provider recovers it answers again
+	ollama.err = nil
+	resp, err := r.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Cached || resp.Provider != "ollama" {
+		t.Errorf("expected a fresh answer from ollama, got %+v", resp)
+	}
+}
+
+func TestCacheKeyIncludesImages(t *testing.T) {
+	req := CompletionRequest{Messages: []Message{{Role: "user", Content: "tag"}}}
+	a := cacheKey("ollama", "llava", req, []Image{{Data: []byte("one"), MimeType: "image/png"}})
+	b := cacheKey("ollama", "llava", req, []Image{{Data: []byte("two"), MimeType: "image/png"}})
+	c := cacheKey("openai", "llava", req, []Image{{Data: []byte("one"), MimeType: "image/png"}})
+	if a == b || a == c {
+		t.Error("expected distinct keys for different images and providers")
+	}
+	if a != cacheKey("ollama", "llava", req, []Image{{Data: []byte("one"), MimeType: "image/png"}}) {
+		t.Error("expected identical requests to share a key")
+	}
+}
@@ -0,0 +1,285 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/bender/internal/logging"
+)
+
+// ErrSchemaMismatch is returned when a structured response still fails
+// validation after the repair attempts are used up
+var ErrSchemaMismatch = errors.New("response does not match schema")
+
+// maxRepairAttempts bounds how often a response that fails schema
+// validation is sent back to the model for correction
+const maxRepairAttempts = 2
+
+// schema is the subset of JSON Schema the validator understands: type,
+// properties, required, additionalProperties, items, enum and the basic
+// length and range keywords. Unknown keywords are ignored.
+type schema struct {
+	Type                 any                `json:"type"` // string or []string
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// validateJSON checks content against the JSON schema in raw. content may
+// be wrapped in a markdown code fence or surrounded by prose; the JSON
+// document is extracted first and returned in compact form.
+func validateJSON(raw json.RawMessage, content string) (string, error) {
+	var s schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("parse schema: %w", err)
+	}
+
+	doc := extractJSON(content)
+	var value any
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return "", fmt.Errorf("%w: invalid JSON: %v", ErrSchemaMismatch, err)
+	}
+	if err := s.validate("$", value); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(doc)); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+	}
+	return buf.String(), nil
+}
+
+// extractJSON returns the JSON document inside content, stripping code
+// fences and any text around the outermost object or array
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if json.Valid([]byte(content)) {
+		return content
+	}
+
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```")
+		if nl := strings.IndexByte(content, '\n'); nl >= 0 {
+			content = content[nl+1:]
+		}
+		content = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+		if json.Valid([]byte(content)) {
+			return content
+		}
+	}
+
+	for _, delims := range [][2]string{{"{", "}"}, {"[", "]"}} {
+		start := strings.Index(content, delims[0])
+		end := strings.LastIndex(content, delims[1])
+		if start >= 0 && end > start && json.Valid([]byte(content[start:end+1])) {
+			return content[start : end+1]
+		}
+	}
+	return content
+}
+
+func (s *schema) validate(path string, v any) error {
+	if s == nil {
+		return nil
+	}
+
+	if types := s.types(); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeName(v))
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equalJSON(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := prop.validate(path+"."+name, val[name]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.MinItems, len(val))
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(val))
+		}
+		for i, item := range val {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case string:
+		n := len([]rune(val))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *s.MaxLength, n)
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			return fmt.Errorf("%s: %v is below the minimum %v", path, f, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fmt.Errorf("%s: %v is above the maximum %v", path, f, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+func (s *schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	default:
+		return typeName(v) == t
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equalJSON compares an enum value from the schema with a decoded value,
+// treating numbers by their numeric value
+func equalJSON(a, b any) bool {
+	if n, ok := b.(json.Number); ok {
+		f, err := n.Float64()
+		af, isNum := a.(float64)
+		return err == nil && isNum && af == f
+	}
+	return a == b
+}
+
+// repairRequest asks the model to correct a response that failed
+// validation, keeping the original conversation for context
+func repairRequest(req CompletionRequest, content string, verr error) CompletionRequest {
+	messages := make([]Message, 0, len(req.Messages)+2)
+	messages = append(messages, req.Messages...)
+	messages = append(messages,
+		Message{Role: "assistant", Content: content},
+		Message{Role: "user", Content: fmt.Sprintf(
+			"That response is invalid: %v. Reply again with only a JSON document that matches this schema, no other text:\n%s",
+			verr, req.ResponseSchema)},
+	)
+	req.Messages = messages
+	req.NoCache = true
+	return req
+}
+
+// structured runs do and, when req has a response schema, validates the
+// result, asking the model to repair it up to maxRepairAttempts times.
+// The returned content is the extracted, compacted JSON document.
+func structured(req CompletionRequest, do func(CompletionRequest) (*CompletionResponse, error)) (*CompletionResponse, error) {
+	resp, err := do(req)
+	if err != nil || len(req.ResponseSchema) == 0 {
+		return resp, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		content, verr := validateJSON(req.ResponseSchema, resp.Content)
+		if verr == nil {
+			resp.Content = content
+			return resp, nil
+		}
+		if !errors.Is(verr, ErrSchemaMismatch) || attempt >= maxRepairAttempts {
+			return nil, verr
+		}
+
+		logging.Warn("structured response from %s failed validation, asking for a repair: %v", resp.Provider, verr)
+		if resp, err = do(repairRequest(req, resp.Content, verr)); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const tagSchema = `{
+	"type": "object",
+	"properties": {
+		"app": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"confidence": {"type": "string", "enum": ["high", "low"]},
+		"score": {"type": "integer", "minimum": 0}
+	},
+	"required": ["app", "tags"],
+	"additionalProperties": false
+}`
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{"valid", `{"app": "Slack", "tags": ["chat"]}`, `{"app":"Slack","tags":["chat"]}`, ""},
+		{"fenced", "```json\n{\"app\": \"Slack\", \"tags\": []}\n```", `{"app":"Slack","tags":[]}`, ""},
+		{"prose", `Here you go: {"app": "Slack", "tags": []} Hope that helps`, `{"app":"Slack","tags":[]}`, ""},
+		{"missing required", `{"app": "Slack"}`, "", `missing required property "tags"`},
+		{"wrong type", `{"app": 3, "tags": []}`, "", "$.app: expected string"},
+		{"enum", `{"app": "x", "tags": [], "confidence": "medium"}`, "", "$.confidence"},
+		{"max items", `{"app": "x", "tags": ["a", "b", "c"]}`, "", "at most 2 items"},
+		{"integer", `{"app": "x", "tags": [], "score": 1.5}`, "", "$.score: expected integer"},
+		{"minimum", `{"app": "x", "tags": [], "score": -1}`, "", "below the minimum"},
+		{"additional", `{"app": "x", "tags": [], "extra": true}`, "", `unexpected property "extra"`},
+		{"not json", `Slack, chat`, "", "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateJSON(json.RawMessage(tagSchema), tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !errors.Is(err, ErrSchemaMismatch) {
+					t.Fatalf("expected schema error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateJSON: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// scriptedProvider answers with each reply in turn, repeating the last one
+type scriptedProvider struct {
+	fakeProvider
+	replies []string
+	reqs    []CompletionRequest
+}
+
+func (s *scriptedProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	s.reqs = append(s.reqs, req)
+	reply := s.replies[min(len(s.reqs), len(s.replies))-1]
+	return &CompletionResponse{Content: reply}, nil
+}
+
+func newScriptedRouter(replies ...string) (*Router, *scriptedProvider) {
+	p := &scriptedProvider{fakeProvider: fakeProvider{name: "ollama"}, replies: replies}
+	r := newTestRouter("ollama", nil)
+	r.addProvider("ollama", p)
+	return r, p
+}
+
+func TestStructuredRepairsInvalidResponse(t *testing.T) {
+	r, p := newScriptedRouter(`{"app": "Slack"}`, `{"app": "Slack", "tags": ["chat"]}`)
+
+	resp, err := r.Complete(context.Background(), CompletionRequest{
+		Messages:       []Message{{Role: "user", Content: "tag it"}},
+		ResponseSchema: json.RawMessage(tagSchema),
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Content != `{"app":"Slack","tags":["chat"]}` {
+		t.Errorf("unexpected content %s", resp.Content)
+	}
+	if len(p.reqs) != 2 {
+		t.Fatalf("expected one repair request, got %d calls", len(p.reqs))
+	}
+	repair := p.reqs[1].Messages
+	if len(repair) != 3 || repair[1].Role != "assistant" || !strings.Contains(repair[2].Content, "tags") {
+		t.Errorf("unexpected repair conversation: %+v", repair)
+	}
+}
+
+func TestStructuredGivesUpAfterRepairAttempts(t *testing.T) {
+	r, p := newScriptedRouter(`not json`)
+
+	_, err := r.Complete(context.Background(), CompletionRequest{ResponseSchema: json.RawMessage(tagSchema)})
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	if len(p.reqs) != 1+maxRepairAttempts {
+		t.Errorf("expected %d calls, got %d", 1+maxRepairAttempts, len(p.reqs))
+	}
+}
+
+func TestOllamaSendsFormat(t *testing.T) {
+	var body map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"{}"},"done":true}`))
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider(OllamaConfig{BaseURL: srv.URL})
+	if _, err := p.Complete(context.Background(), CompletionRequest{ResponseSchema: json.RawMessage(`{"type":"object"}`)}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if string(body["format"]) != `{"type":"object"}` {
+		t.Errorf("expected schema in format, got %s", body["format"])
+	}
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxStreamLine bounds a single NDJSON or SSE line
+const maxStreamLine = 1 << 20
+
+// errStreamIdle is returned when a stream goes a provider's timeout without
+// delivering data. It wraps context.DeadlineExceeded so it is retryable.
+var errStreamIdle = fmt.Errorf("stream idle: %w", context.DeadlineExceeded)
+
+// newHTTPClient returns a client whose timeout covers connecting and
+// waiting for the response headers but not reading the body, which would
+// cut off long streams. Non-streaming calls bound the whole request with a
+// context deadline instead.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// idleTimeout cancels a streaming request once it goes timeout without
+// receiving data. Unlike a deadline it restarts with every chunk, so a
+// stream may run as long as it keeps producing.
+type idleTimeout struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleTimeout(parent context.Context, timeout time.Duration) *idleTimeout {
+	ctx, cancel := context.WithCancelCause(parent)
+	return &idleTimeout{
+		ctx:     ctx,
+		cancel:  cancel,
+		timer:   time.AfterFunc(timeout, func() { cancel(errStreamIdle) }),
+		timeout: timeout,
+	}
+}
+
+// reader wraps a response body, restarting the timeout whenever data
+// arrives
+func (t *idleTimeout) reader(r io.Reader) io.Reader {
+	return &idleReader{r: r, t: t}
+}
+
+// err replaces err with errStreamIdle if the stream was cut off for going
+// idle
+func (t *idleTimeout) err(err error) error {
+	if err != nil && errors.Is(context.Cause(t.ctx), errStreamIdle) {
+		return errStreamIdle
+	}
+	return err
+}
+
+func (t *idleTimeout) stop() {
+	t.timer.Stop()
+	t.cancel(nil)
+}
+
+type idleReader struct {
+	r io.Reader
+	t *idleTimeout
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.timer.Reset(r.t.timeout)
+	}
+	return n, err
+}
+
+// readLines calls fn for each non-empty line read from r
+func readLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
+
+// readSSE parses a server-sent event stream, calling fn with the event name
+// and data of each event. Multi-line data fields are joined with newlines.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return dispatch()
+}
+
+// Stream sends a streaming completion request to the default provider.
+// Failover to the next provider only happens while nothing has been emitted
+// yet; once a chunk has reached onDelta, errors are returned as-is. A cached
+// response is emitted as a single chunk. ResponseSchema is passed on to the
+// provider but, unlike Complete, the streamed output is not validated.
+func (r *Router) Stream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	target, model := r.applyRoute(&req)
+	if target == "" {
+		target = r.DefaultProviderName()
+	}
+
+	names := r.chain(target)
+	if len(names) == 0 {
+		return nil, ErrProviderNotFound
+	}
+
+	key := cacheKey(target, model, req, nil)
+	if resp := r.cached(key, req); resp != nil {
+		if err := onDelta(resp.Content); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	emitted := false
+	resp, err := r.failover(ctx, req, names, func(name string, p Provider) (*CompletionResponse, error) {
+		emitted = false
+		return p.Stream(ctx, withRouteModel(req, name, target, model), func(delta string) error {
+			emitted = true
+			return onDelta(delta)
+		})
+	}, func(err error) bool {
+		return !emitted && IsRetryable(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.store(key, target, resp)
+	return resp, nil
+}
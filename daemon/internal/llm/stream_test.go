@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSSE(t *testing.T) {
+	input := ": keep-alive\n\nevent: message_start\ndata: {\"a\":1}\n\ndata: line one\ndata: line two\n\ndata: [DONE]\n"
+
+	var events, datas []string
+	err := readSSE(strings.NewReader(input), func(event, data string) error {
+		events = append(events, event)
+		datas = append(datas, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readSSE: %v", err)
+	}
+
+	if len(datas) != 3 {
+		t.Fatalf("expected 3 events, got %d: %v", len(datas), datas)
+	}
+	if events[0] != "message_start" || datas[0] != `{"a":1}` {
+		t.Errorf("unexpected first event %q %q", events[0], datas[0])
+	}
+	if datas[1] != "line one\nline two" {
+		t.Errorf("expected joined data, got %q", datas[1])
+	}
+	if events[1] != "" {
+		t.Errorf("event name should reset between events, got %q", events[1])
+	}
+	if datas[2] != "[DONE]" {
+		t.Errorf("expected [DONE], got %q", datas[2])
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hello"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":", world"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":3}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider(OllamaConfig{BaseURL: srv.URL})
+
+	var deltas []string
+	resp, err := p.Stream(context.Background(), CompletionRequest{
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if resp.Content != "Hello, world" {
+		t.Errorf("expected accumulated content, got %q", resp.Content)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("expected 2 deltas, got %v", deltas)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 3 || resp.Usage.TotalTokens != 15 {
+		t.Errorf("expected usage from final chunk, got %+v", resp.Usage)
+	}
+	if resp.Model != "llama3.2" {
+		t.Errorf("expected model llama3.2, got %q", resp.Model)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	stall := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"x"},"done":false}`)
+			w.(http.Flusher).Flush()
+			time.Sleep(60 * time.Millisecond)
+		}
+		if stall {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider(OllamaConfig{BaseURL: srv.URL})
+	p.timeout = 150 * time.Millisecond
+	req := CompletionRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	noop := func(string) error { return nil }
+
+	// The stream outlasts the timeout but never goes quiet for that long
+	resp, err := p.Stream(context.Background(), req, noop)
+	if err != nil || resp.Content != "xxxx" {
+		t.Fatalf("expected the whole stream, got %v %v", resp, err)
+	}
+
+	stall = true
+	if _, err := p.Stream(context.Background(), req, noop); !errors.Is(err, errStreamIdle) || !IsRetryable(err) {
+		t.Errorf("expected a retryable idle error, got %v", err)
+	}
+}
+
+func TestRouterStreamFailsOverBeforeFirstChunk(t *testing.T) {
+	ollama := &fakeProvider{name: "ollama", err: &ProviderError{Provider: "ollama", StatusCode: 503}}
+	openai := &fakeProvider{name: "openai"}
+	r := newTestRouter("ollama", []string{"openai"}, ollama, openai)
+
+	var got []string
+	resp, err := r.Stream(context.Background(), CompletionRequest{}, func(delta string) error {
+		got = append(got, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if resp.Provider != "openai" {
+		t.Errorf("expected provider openai, got %s", resp.Provider)
+	}
+	if strings.Join(got, " ") != "from openai" {
+		t.Errorf("unexpected deltas %v", got)
+	}
+}
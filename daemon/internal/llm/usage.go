@@ -0,0 +1,45 @@
+package llm
+
+import "context"
+
+// UsageEvent describes the tokens consumed by one successful completion
+type UsageEvent struct {
+	Provider string
+	Model    string
+	Route    string
+	Usage    Usage
+}
+
+// UsageFunc is called after every successful completion
+type UsageFunc func(ctx context.Context, ev UsageEvent)
+
+// OnUsage registers fn to receive a UsageEvent for every completion served
+// by the router, whichever provider in the chain answered
+func (r *Router) OnUsage(fn UsageFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usageHooks = append(r.usageHooks, fn)
+}
+
+func (r *Router) reportUsage(ctx context.Context, req CompletionRequest, resp *CompletionResponse) {
+	r.mu.RLock()
+	hooks := r.usageHooks
+	r.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	ev := UsageEvent{
+		Provider: resp.Provider,
+		Model:    model,
+		Route:    req.Route,
+		Usage:    resp.Usage,
+	}
+	for _, fn := range hooks {
+		fn(ctx, ev)
+	}
+}
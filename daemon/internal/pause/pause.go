@@ -0,0 +1,244 @@
+package pause
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/user/bender/internal/logging"
+)
+
+// Target is something that can be paused: the task queue or a trigger
+type Target interface {
+	Pause()
+	Resume()
+}
+
+// State is the pause state of one target
+type State struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+	// Until is when the target resumes by itself, if it does
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Manager pauses and resumes named targets, persisting the paused ones in
+// SQLite so they stay paused across a restart
+type Manager struct {
+	db      *sql.DB
+	mu      sync.Mutex
+	targets map[string]Target
+	paused  map[string]time.Time // zero until means indefinitely
+	timers  map[string]*time.Timer
+}
+
+// New opens the pauses table in the given database, creating it if needed,
+// and loads the saved state
+func New(dbPath string) (*Manager, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS pauses (
+			name TEXT PRIMARY KEY,
+			until INTEGER -- unix ms, NULL until resumed by hand
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+
+	m := &Manager{
+		db:      db,
+		targets: make(map[string]Target),
+		paused:  make(map[string]time.Time),
+		timers:  make(map[string]*time.Timer),
+	}
+
+	rows, err := db.Query(`SELECT name, until FROM pauses`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load pauses: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var until sql.NullInt64
+		if err := rows.Scan(&name, &until); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("load pauses: %w", err)
+		}
+		var t time.Time
+		if until.Valid {
+			t = time.UnixMilli(until.Int64)
+		}
+		m.paused[name] = t
+	}
+	if err := rows.Err(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load pauses: %w", err)
+	}
+	return m, nil
+}
+
+// Close stops pending auto-resumes and closes the database
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	for _, t := range m.timers {
+		t.Stop()
+	}
+	m.mu.Unlock()
+	return m.db.Close()
+}
+
+// Register adds a target under name. If it was paused when the daemon
+// last stopped it is paused again, unless its auto-resume time has passed.
+func (m *Manager) Register(name string, target Target) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.targets[name] = target
+	until, ok := m.paused[name]
+	if !ok {
+		return
+	}
+	if !until.IsZero() && !until.After(time.Now()) {
+		m.clear(name)
+		return
+	}
+	target.Pause()
+	m.schedule(name, until)
+	logging.Info("%s paused (restored)", name)
+}
+
+// Pause pauses the named target. A non-zero until resumes it at that time.
+func (m *Manager) Pause(name string, until time.Time) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target, ok := m.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s", name)
+	}
+	if !until.IsZero() && !until.After(time.Now()) {
+		return nil, fmt.Errorf("resume time %s is in the past", until.Format(time.RFC3339))
+	}
+
+	var untilMs any
+	if !until.IsZero() {
+		untilMs = until.UnixMilli()
+	}
+	_, err := m.db.Exec(`INSERT OR REPLACE INTO pauses (name, until) VALUES (?, ?)`, name, untilMs)
+	if err != nil {
+		return nil, fmt.Errorf("save pause: %w", err)
+	}
+
+	m.paused[name] = until
+	target.Pause()
+	m.schedule(name, until)
+	if until.IsZero() {
+		logging.Info("%s paused", name)
+	} else {
+		logging.Info("%s paused until %s", name, until.Format(time.RFC3339))
+	}
+	return m.state(name), nil
+}
+
+// Resume resumes the named target. Resuming one that is not paused is a
+// no-op.
+func (m *Manager) Resume(name string) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target, ok := m.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s", name)
+	}
+	if _, paused := m.paused[name]; paused {
+		if err := m.clear(name); err != nil {
+			return nil, err
+		}
+		target.Resume()
+		logging.Info("%s resumed", name)
+	}
+	return m.state(name), nil
+}
+
+// Get returns the state of the named target
+func (m *Manager) Get(name string) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.targets[name]; !ok {
+		return nil, fmt.Errorf("unknown target: %s", name)
+	}
+	return m.state(name), nil
+}
+
+// List returns the state of every registered target, by name
+func (m *Manager) List() []State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make([]State, 0, len(m.targets))
+	for name := range m.targets {
+		states = append(states, *m.state(name))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// schedule arms the auto-resume of name, replacing any earlier one. The
+// caller holds m.mu.
+func (m *Manager) schedule(name string, until time.Time) {
+	if t := m.timers[name]; t != nil {
+		t.Stop()
+		delete(m.timers, name)
+	}
+	if until.IsZero() {
+		return
+	}
+	m.timers[name] = time.AfterFunc(time.Until(until), func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// A later Pause or Resume may have replaced this one
+		if current, ok := m.paused[name]; !ok || !current.Equal(until) {
+			return
+		}
+		if err := m.clear(name); err != nil {
+			logging.Warn("auto-resume %s: %v", name, err)
+		}
+		m.targets[name].Resume()
+		logging.Info("%s resumed (pause expired)", name)
+	})
+}
+
+// clear forgets that name is paused. The caller holds m.mu.
+func (m *Manager) clear(name string) error {
+	delete(m.paused, name)
+	if t := m.timers[name]; t != nil {
+		t.Stop()
+		delete(m.timers, name)
+	}
+	if _, err := m.db.Exec(`DELETE FROM pauses WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("clear pause: %w", err)
+	}
+	return nil
+}
+
+// state builds the state of name. The caller holds m.mu.
+func (m *Manager) state(name string) *State {
+	s := &State{Name: name}
+	if until, ok := m.paused[name]; ok {
+		s.Paused = true
+		if !until.IsZero() {
+			s.Until = &until
+		}
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package pause
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	mu     sync.Mutex
+	paused bool
+}
+
+func (f *fakeTarget) Pause()  { f.mu.Lock(); f.paused = true; f.mu.Unlock() }
+func (f *fakeTarget) Resume() { f.mu.Lock(); f.paused = false; f.mu.Unlock() }
+
+func (f *fakeTarget) isPaused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused
+}
+
+func newTestManager(t *testing.T, dbPath string) *Manager {
+	t.Helper()
+	m, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestPauseSurvivesRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	m := newTestManager(t, dbPath)
+	m.Register("clipboard", &fakeTarget{})
+	if _, err := m.Pause("clipboard", time.Time{}); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	m.Close()
+
+	m = newTestManager(t, dbPath)
+	defer m.Close()
+	target := &fakeTarget{}
+	m.Register("clipboard", target)
+	if !target.isPaused() {
+		t.Fatal("expected pause to be restored")
+	}
+
+	state, err := m.Resume("clipboard")
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if state.Paused || target.isPaused() {
+		t.Errorf("expected resumed, got %+v", state)
+	}
+}
+
+func TestPauseAutoResumes(t *testing.T) {
+	m := newTestManager(t, filepath.Join(t.TempDir(), "test.db"))
+	defer m.Close()
+	target := &fakeTarget{}
+	m.Register("queue", target)
+
+	until := time.Now().Add(50 * time.Millisecond)
+	state, err := m.Pause("queue", until)
+	if err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if !state.Paused || state.Until == nil || !state.Until.Equal(until) {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for target.isPaused() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if target.isPaused() {
+		t.Fatal("expected the pause to expire")
+	}
+	if s, _ := m.Get("queue"); s.Paused {
+		t.Errorf("expected state resumed, got %+v", s)
+	}
+}
+
+func TestExpiredPauseNotRestored(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	m := newTestManager(t, dbPath)
+	m.Register("auto_file", &fakeTarget{})
+	m.Pause("auto_file", time.Now().Add(time.Hour))
+	m.db.Exec(`UPDATE pauses SET until = ?`, time.Now().Add(-time.Minute).UnixMilli())
+	m.Close()
+
+	m = newTestManager(t, dbPath)
+	defer m.Close()
+	target := &fakeTarget{}
+	m.Register("auto_file", target)
+	if target.isPaused() {
+		t.Error("expired pause should not be restored")
+	}
+}
+
+func TestPauseUnknownTarget(t *testing.T) {
+	m := newTestManager(t, filepath.Join(t.TempDir(), "test.db"))
+	defer m.Close()
+	if _, err := m.Pause("nope", time.Time{}); err == nil {
+		t.Error("expected error for unknown target")
+	}
+	m.Register("clipboard", &fakeTarget{})
+	if _, err := m.Pause("clipboard", time.Now().Add(-time.Minute)); err == nil {
+		t.Error("expected error for a resume time in the past")
+	}
+}
@@ -0,0 +1,351 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/user/bender/internal/logging"
+	"github.com/user/bender/internal/task"
+)
+
+// maxSleep bounds how long the scheduler sleeps between checks, so clock
+// changes and sleep/wake are noticed
+const maxSleep = time.Minute
+
+// minSleep keeps a schedule whose next run could not be saved, and so stays
+// due, from firing in a tight loop
+const minSleep = time.Second
+
+// schedulable lists the task types a schedule may enqueue. The steps of a
+// job are left out: each needs the result of the step before it.
+var schedulable = map[task.TaskType]bool{
+	task.TaskClipboardSummarize: true,
+	task.TaskFileClassify:       true,
+	task.TaskFileRename:         true,
+	task.TaskGitCommit:          true,
+	task.TaskScreenshotTag:      true,
+	task.TaskPipelineAutoFile:   true,
+	task.TaskPipelineScreenshot: true,
+	task.TaskAutoFileSweep:      true,
+	task.TaskUndoCleanup:        true,
+}
+
+// Schedule enqueues a task on a cron expression or once at RunAt
+type Schedule struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name,omitempty"`
+	Cron       string          `json:"cron,omitempty"`
+	RunAt      *time.Time      `json:"run_at,omitempty"`
+	TaskType   task.TaskType   `json:"task_type"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	NextRun    *time.Time      `json:"next_run,omitempty"`
+	LastRun    *time.Time      `json:"last_run,omitempty"`
+	LastTaskID string          `json:"last_task_id,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Config for the scheduler
+type Config struct {
+	DBPath string
+	Queue  *task.Queue
+}
+
+// Scheduler persists schedules in SQLite and enqueues their tasks when they
+// come due. A schedule missed while the daemon was stopped runs once on
+// start.
+type Scheduler struct {
+	db    *sql.DB
+	queue *task.Queue
+	wake  chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New opens the schedules table in the given database, creating it if needed
+func New(cfg Config) (*Scheduler, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS schedules (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			cron TEXT,
+			run_at DATETIME,
+			task_type TEXT NOT NULL,
+			payload TEXT,
+			next_run INTEGER, -- unix ms, NULL once a one-off has run
+			last_run DATETIME,
+			last_task_id TEXT,
+			last_error TEXT,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_schedules_next_run ON schedules(next_run);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		db:     db,
+		queue:  cfg.Queue,
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Start begins firing due schedules
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+	logging.Info("scheduler started")
+}
+
+// Stop halts the scheduler and closes the database
+func (s *Scheduler) Stop() error {
+	s.cancel()
+	s.wg.Wait()
+	logging.Info("scheduler stopped")
+	return s.db.Close()
+}
+
+// Add validates and stores a schedule. Exactly one of Cron and RunAt must
+// be set, and the task type must be schedulable and have a registered
+// handler.
+func (s *Scheduler) Add(sch Schedule) (*Schedule, error) {
+	if !schedulable[sch.TaskType] {
+		return nil, fmt.Errorf("task type %s cannot be scheduled", sch.TaskType)
+	}
+	if !s.queue.HasHandler(sch.TaskType) {
+		return nil, fmt.Errorf("unknown task type: %s", sch.TaskType)
+	}
+	if len(sch.Payload) > 0 && !json.Valid(sch.Payload) {
+		return nil, fmt.Errorf("payload is not valid JSON")
+	}
+
+	now := time.Now()
+	var next time.Time
+	switch {
+	case sch.Cron != "" && sch.RunAt != nil:
+		return nil, fmt.Errorf("set either cron or run_at, not both")
+	case sch.Cron != "":
+		c, err := ParseCron(sch.Cron)
+		if err != nil {
+			return nil, err
+		}
+		if next = c.Next(now); next.IsZero() {
+			return nil, fmt.Errorf("cron %q never runs", sch.Cron)
+		}
+	case sch.RunAt != nil:
+		next = *sch.RunAt
+	default:
+		return nil, fmt.Errorf("cron or run_at is required")
+	}
+
+	sch.ID = fmt.Sprintf("%d", now.UnixNano())
+	sch.NextRun = &next
+	sch.CreatedAt = now
+	sch.LastRun, sch.LastTaskID, sch.LastError = nil, "", ""
+
+	_, err := s.db.Exec(`
+		INSERT INTO schedules (id, name, cron, run_at, task_type, payload, next_run, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, sch.ID, sch.Name, sch.Cron, sch.RunAt, sch.TaskType, nullPayload(sch.Payload), next.UnixMilli(), sch.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert schedule: %w", err)
+	}
+
+	s.poke()
+	logging.Info("schedule %s added: %s at %s", sch.ID, sch.TaskType, next.Format(time.RFC3339))
+	return &sch, nil
+}
+
+// List returns all schedules, soonest first
+func (s *Scheduler) List() ([]*Schedule, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, cron, run_at, task_type, payload, next_run, last_run, last_task_id, last_error, created_at
+		FROM schedules ORDER BY next_run IS NULL, next_run ASC, created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		var sch Schedule
+		var name, cron, payload, lastTaskID, lastError sql.NullString
+		var runAt, lastRun sql.NullTime
+		var nextRun sql.NullInt64
+		err := rows.Scan(&sch.ID, &name, &cron, &runAt, &sch.TaskType, &payload, &nextRun, &lastRun, &lastTaskID, &lastError, &sch.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sch.Name = name.String
+		sch.Cron = cron.String
+		if runAt.Valid {
+			sch.RunAt = &runAt.Time
+		}
+		if payload.Valid {
+			sch.Payload = json.RawMessage(payload.String)
+		}
+		if nextRun.Valid {
+			t := time.UnixMilli(nextRun.Int64)
+			sch.NextRun = &t
+		}
+		if lastRun.Valid {
+			sch.LastRun = &lastRun.Time
+		}
+		sch.LastTaskID = lastTaskID.String
+		sch.LastError = lastError.String
+		schedules = append(schedules, &sch)
+	}
+	return schedules, rows.Err()
+}
+
+// Remove deletes a schedule
+func (s *Scheduler) Remove(id string) error {
+	res, err := s.db.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("schedule %s not found", id)
+	}
+	s.poke()
+	logging.Info("schedule %s removed", id)
+	return nil
+}
+
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	for {
+		s.fireDue(time.Now())
+
+		timer := time.NewTimer(s.untilNext())
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// dueSchedule is the part of a schedule needed to fire it
+type dueSchedule struct {
+	id       string
+	cron     string
+	taskType task.TaskType
+	payload  json.RawMessage
+}
+
+// fireDue enqueues the task of every schedule due at now and moves each to
+// its next run. A cron schedule that missed several runs fires once.
+func (s *Scheduler) fireDue(now time.Time) {
+	rows, err := s.db.Query(`
+		SELECT id, cron, task_type, payload FROM schedules
+		WHERE next_run IS NOT NULL AND next_run <= ?
+	`, now.UnixMilli())
+	if err != nil {
+		logging.Error("scheduler: query due schedules: %v", err)
+		return
+	}
+	var due []dueSchedule
+	for rows.Next() {
+		var d dueSchedule
+		var cron, payload sql.NullString
+		if err := rows.Scan(&d.id, &cron, &d.taskType, &payload); err != nil {
+			logging.Error("scheduler: scan schedule: %v", err)
+			continue
+		}
+		d.cron = cron.String
+		if payload.Valid {
+			d.payload = json.RawMessage(payload.String)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		s.fire(d, now)
+	}
+}
+
+func (s *Scheduler) fire(d dueSchedule, now time.Time) {
+	t, err := s.queue.Enqueue(d.taskType, d.payload, task.PriorityBackground)
+	var taskID, lastError sql.NullString
+	if err != nil {
+		logging.Warn("schedule %s: enqueue %s: %v", d.id, d.taskType, err)
+		lastError = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		taskID = sql.NullString{String: t.ID, Valid: true}
+		logging.Debug("schedule %s: enqueued %s task %s", d.id, d.taskType, t.ID)
+	}
+
+	var next sql.NullInt64
+	if d.cron != "" {
+		if c, err := ParseCron(d.cron); err == nil {
+			if n := c.Next(now); !n.IsZero() {
+				next = sql.NullInt64{Int64: n.UnixMilli(), Valid: true}
+			}
+		}
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE schedules SET next_run = ?, last_run = ?, last_task_id = COALESCE(?, last_task_id), last_error = ?
+		WHERE id = ?
+	`, next, now, taskID, lastError, d.id)
+	if err != nil {
+		logging.Error("scheduler: update schedule %s, it stays due: %v", d.id, err)
+	}
+}
+
+// untilNext returns how long to sleep before the next schedule is due,
+// between minSleep and maxSleep
+func (s *Scheduler) untilNext() time.Duration {
+	wait := maxSleep
+	var next sql.NullInt64
+	err := s.db.QueryRow(`SELECT MIN(next_run) FROM schedules WHERE next_run IS NOT NULL`).Scan(&next)
+	if err != nil {
+		logging.Error("scheduler: query next run: %v", err)
+	} else if next.Valid {
+		if d := time.Until(time.UnixMilli(next.Int64)); d < wait {
+			wait = d
+		}
+	}
+	if wait < minSleep {
+		wait = minSleep
+	}
+	return wait
+}
+
+func nullPayload(p json.RawMessage) sql.NullString {
+	if len(p) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(p), Valid: true}
+}
@@ -0,0 +1,165 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/bender/internal/task"
+)
+
+func newTestScheduler(t *testing.T) (*Scheduler, *task.Queue) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	q, err := task.NewQueue(task.Config{DBPath: dbPath, MaxWorkers: 1})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	t.Cleanup(func() { q.Stop() })
+	q.RegisterHandler(task.TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return payload, nil
+	})
+
+	s, err := New(Config{DBPath: dbPath, Queue: q})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s, q
+}
+
+func TestAddValidates(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	now := time.Now()
+	bad := []Schedule{
+		{TaskType: task.TaskFileClassify},
+		{TaskType: task.TaskFileClassify, Cron: "@daily", RunAt: &now},
+		{TaskType: task.TaskFileClassify, Cron: "nope"},
+		{TaskType: task.TaskGitCommit, Cron: "@daily"},
+		{TaskType: task.TaskFileClassify, Cron: "@daily", Payload: json.RawMessage(`{`)},
+	}
+	for _, sch := range bad {
+		if _, err := s.Add(sch); err == nil {
+			t.Errorf("expected error adding %+v", sch)
+		}
+	}
+}
+
+func TestAddRejectsJobSteps(t *testing.T) {
+	s, q := newTestScheduler(t)
+	q.RegisterHandler(task.TaskAutoFileMove, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return payload, nil
+	})
+
+	_, err := s.Add(Schedule{Cron: "@daily", TaskType: task.TaskAutoFileMove})
+	if err == nil || !strings.Contains(err.Error(), "cannot be scheduled") {
+		t.Errorf("expected job step to be refused, got %v", err)
+	}
+}
+
+func TestAddListRemove(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	added, err := s.Add(Schedule{Name: "sweep", Cron: "0 3 * * *", TaskType: task.TaskFileClassify, Payload: json.RawMessage(`{"path":"/tmp"}`)})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if added.NextRun == nil || added.NextRun.Hour() != 3 {
+		t.Errorf("expected next run at 03:00, got %v", added.NextRun)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "sweep" || string(list[0].Payload) != `{"path":"/tmp"}` {
+		t.Fatalf("unexpected schedules: %+v", list)
+	}
+
+	if err := s.Remove(added.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := s.Remove(added.ID); err == nil {
+		t.Error("expected error removing a missing schedule")
+	}
+	if list, _ := s.List(); len(list) != 0 {
+		t.Errorf("expected no schedules, got %d", len(list))
+	}
+}
+
+func TestFireDue(t *testing.T) {
+	s, q := newTestScheduler(t)
+
+	past := time.Now().Add(-time.Hour)
+	once, _ := s.Add(Schedule{RunAt: &past, TaskType: task.TaskFileClassify, Payload: json.RawMessage(`{"n":1}`)})
+	cron, _ := s.Add(Schedule{Cron: "* * * * *", TaskType: task.TaskFileClassify})
+
+	// Pretend the cron schedule's run was missed several times over
+	s.db.Exec(`UPDATE schedules SET next_run = ? WHERE id = ?`, past.UnixMilli(), cron.ID)
+	s.fireDue(time.Now())
+
+	tasks, _ := q.ListTasks(10)
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(tasks))
+	}
+
+	list, _ := s.List()
+	for _, sch := range list {
+		if sch.LastTaskID == "" || sch.LastRun == nil {
+			t.Errorf("schedule %s: expected last run to be recorded", sch.ID)
+		}
+		switch sch.ID {
+		case once.ID:
+			if sch.NextRun != nil {
+				t.Errorf("one-off schedule should not run again, next %v", sch.NextRun)
+			}
+		case cron.ID:
+			if sch.NextRun == nil || !sch.NextRun.After(time.Now()) {
+				t.Errorf("cron schedule should move to a future run, got %v", sch.NextRun)
+			}
+		}
+	}
+
+	// A schedule left due, as when saving its next run fails, does not spin
+	s.db.Exec(`UPDATE schedules SET next_run = ? WHERE id = ?`, past.UnixMilli(), cron.ID)
+	if wait := s.untilNext(); wait < minSleep {
+		t.Errorf("expected at least %v before firing again, got %v", minSleep, wait)
+	}
+	s.db.Exec(`UPDATE schedules SET next_run = ? WHERE id = ?`, time.Now().Add(time.Hour).UnixMilli(), cron.ID)
+
+	// Nothing is due any more
+	s.fireDue(time.Now())
+	if tasks, _ := q.ListTasks(10); len(tasks) != 2 {
+		t.Errorf("expected no new tasks, got %d", len(tasks))
+	}
+}
+
+func TestStartFiresDueSchedule(t *testing.T) {
+	s, q := newTestScheduler(t)
+	q.Start()
+
+	events, stop := q.Subscribe(16)
+	defer stop()
+
+	s.Start()
+	runAt := time.Now().Add(50 * time.Millisecond)
+	if _, err := s.Add(Schedule{RunAt: &runAt, TaskType: task.TaskFileClassify}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Status == task.StatusCompleted {
+				return
+			}
+		case <-timeout:
+			t.Fatal("scheduled task did not run")
+		}
+	}
+}
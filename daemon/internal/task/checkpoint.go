@@ -0,0 +1,56 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const checkpointKey contextKey = "checkpoint"
+
+// checkpointer saves progress for the task a handler is running
+type checkpointer struct {
+	q    *Queue
+	task *Task
+}
+
+// Checkpoint saves state for the running task. If the task is interrupted
+// by a shutdown or fails and is retried, the next attempt reads it back with
+// LastCheckpoint and can skip the steps already done. Outside a task it
+// does nothing.
+func Checkpoint(ctx context.Context, state any) error {
+	c, ok := ctx.Value(checkpointKey).(*checkpointer)
+	if !ok {
+		return nil
+	}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	// Saved even once ctx is cancelled: a step that finished during
+	// shutdown must not be repeated
+	res, err := c.q.db.Exec(`
+		UPDATE tasks SET checkpoint = ? WHERE id = ? AND status = 'running' AND lease_id = ?
+	`, string(raw), c.task.ID, c.task.lease)
+	if err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("task %s is no longer running here", c.task.ID)
+	}
+	c.task.Checkpoint = raw
+	return nil
+}
+
+// LastCheckpoint decodes the state last saved with Checkpoint for the
+// running task into v, reporting whether there was one
+func LastCheckpoint(ctx context.Context, v any) (bool, error) {
+	c, ok := ctx.Value(checkpointKey).(*checkpointer)
+	if !ok || len(c.task.Checkpoint) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(c.task.Checkpoint, v); err != nil {
+		return false, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return true, nil
+}
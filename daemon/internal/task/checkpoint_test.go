@@ -0,0 +1,132 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type progress struct {
+	Step int `json:"step"`
+}
+
+func TestCheckpointSurvivesRetry(t *testing.T) {
+	q := newTestQueue(t)
+
+	var resumedAt []int
+	q.RegisterHandler(TaskPipelineScreenshot, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		var p progress
+		if _, err := LastCheckpoint(ctx, &p); err != nil {
+			return nil, err
+		}
+		resumedAt = append(resumedAt, p.Step)
+		if p.Step == 0 {
+			if err := Checkpoint(ctx, progress{Step: 1}); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("interrupted after step 1")
+		}
+		return json.RawMessage(`{}`), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.EnqueueAndWait(ctx, TaskPipelineScreenshot, json.RawMessage(`{}`), PriorityInteractive)
+	if err != nil {
+		t.Fatalf("EnqueueAndWait: %v", err)
+	}
+	if len(resumedAt) != 2 || resumedAt[0] != 0 || resumedAt[1] != 1 {
+		t.Errorf("expected the retry to resume at step 1, got %v", resumedAt)
+	}
+	if string(result.Checkpoint) != `{"step":1}` {
+		t.Errorf("expected checkpoint stored with the task, got %s", result.Checkpoint)
+	}
+}
+
+func TestCheckpointOutsideTask(t *testing.T) {
+	if err := Checkpoint(context.Background(), progress{Step: 1}); err != nil {
+		t.Errorf("expected no-op outside a task, got %v", err)
+	}
+	var p progress
+	if ok, err := LastCheckpoint(context.Background(), &p); ok || err != nil {
+		t.Errorf("expected no checkpoint outside a task, got %v %v", ok, err)
+	}
+}
+
+func TestStopDrainsRunningTasks(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	q, err := NewQueue(Config{DBPath: dbPath, MaxWorkers: 1, DrainTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	started := make(chan struct{})
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return json.RawMessage(`{}`), ctx.Err()
+	})
+	q.Start()
+
+	task, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityInteractive)
+	queued, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	<-started
+	q.Stop()
+
+	// Reopen to inspect what Stop left behind
+	q, _ = NewQueue(Config{DBPath: dbPath})
+	defer q.Stop()
+	if got, _ := q.GetTask(task.ID); got.Status != StatusCompleted {
+		t.Errorf("expected the running task to finish during the drain, got %s", got.Status)
+	}
+	if got, _ := q.GetTask(queued.ID); got.Status != StatusPending {
+		t.Errorf("expected no new task claimed while draining, got %s", got.Status)
+	}
+}
+
+func TestStopInterruptsAfterDrainTimeout(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	q, err := NewQueue(Config{DBPath: dbPath, MaxWorkers: 1, DrainTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	started := make(chan struct{})
+	q.RegisterHandler(TaskPipelineScreenshot, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		Checkpoint(ctx, progress{Step: 2})
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	q.Start()
+
+	task, _ := q.Enqueue(TaskPipelineScreenshot, json.RawMessage(`{}`), PriorityInteractive)
+	<-started
+	q.Stop()
+
+	q, _ = NewQueue(Config{DBPath: dbPath, MaxWorkers: 1})
+	var resumed progress
+	done := make(chan struct{})
+	q.RegisterHandler(TaskPipelineScreenshot, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		LastCheckpoint(ctx, &resumed)
+		close(done)
+		return json.RawMessage(`{}`), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupted task was not run after restart")
+	}
+	if resumed.Step != 2 {
+		t.Errorf("expected to resume from step 2, got %+v", resumed)
+	}
+	if got, _ := q.GetTask(task.ID); got.RetryCount != 0 {
+		t.Errorf("an interrupted run should not count as a retry, got %d", got.RetryCount)
+	}
+}
@@ -0,0 +1,270 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/bender/internal/logging"
+)
+
+// Attempt is one run of a task's handler
+type Attempt struct {
+	Attempt    int        `json:"attempt"`
+	Status     TaskStatus `json:"status"` // completed or failed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+}
+
+// DeadLetter is a failed task with its attempt history
+type DeadLetter struct {
+	*Task
+	Attempts []Attempt `json:"attempts"`
+}
+
+// DeadLetterPage is one page of DeadLetters results, newest first
+type DeadLetterPage struct {
+	Tasks      []DeadLetter `json:"tasks"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// RetryFilter selects failed tasks for RetryFailed. Zero fields do not
+// filter.
+type RetryFilter struct {
+	Types []TaskType `json:"types,omitempty"`
+	// Since and Until bound when the task failed: Since inclusive, Until
+	// exclusive
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+}
+
+// initAttempts creates the log of handler runs, kept apart from the tasks
+// table so a task's history survives its retries
+func initAttempts(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS task_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id TEXT NOT NULL,
+			attempt INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_task_attempts_task ON task_attempts(task_id);
+	`)
+	return err
+}
+
+// recordAttempt logs the outcome of running a task's handler
+func (q *Queue) recordAttempt(task *Task, err error) {
+	status, msg := StatusCompleted, ""
+	if err != nil {
+		status, msg = StatusFailed, err.Error()
+	}
+	started := time.Now()
+	if task.StartedAt != nil {
+		started = *task.StartedAt
+	}
+	_, dbErr := q.db.Exec(`
+		INSERT INTO task_attempts (task_id, attempt, status, error, started_at, finished_at)
+		SELECT ?, COUNT(*) + 1, ?, ?, ?, ? FROM task_attempts WHERE task_id = ?
+	`, task.ID, status, nullString(msg), started, time.Now(), task.ID)
+	if dbErr != nil {
+		logging.Warn("failed to record attempt of task %s: %v", task.ID, dbErr)
+	}
+}
+
+// Attempts returns the attempt history of a task, oldest first
+func (q *Queue) Attempts(id string) ([]Attempt, error) {
+	rows, err := q.db.Query(`
+		SELECT attempt, status, error, started_at, finished_at
+		FROM task_attempts WHERE task_id = ? ORDER BY attempt ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var errStr sql.NullString
+		if err := rows.Scan(&a.Attempt, &a.Status, &errStr, &a.StartedAt, &a.FinishedAt); err != nil {
+			return nil, err
+		}
+		a.Error = errStr.String
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// DeadLetters lists failed tasks with their payloads and attempt history.
+// The query's status filter is ignored.
+func (q *Queue) DeadLetters(query TaskQuery) (*DeadLetterPage, error) {
+	query.Statuses = []TaskStatus{StatusFailed}
+	page, err := q.QueryTasks(query)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &DeadLetterPage{Tasks: make([]DeadLetter, 0, len(page.Tasks)), NextCursor: page.NextCursor}
+	for _, t := range page.Tasks {
+		attempts, err := q.Attempts(t.ID)
+		if err != nil {
+			return nil, fmt.Errorf("load attempts of task %s: %w", t.ID, err)
+		}
+		out.Tasks = append(out.Tasks, DeadLetter{Task: t, Attempts: attempts})
+	}
+	return out, nil
+}
+
+// Retry puts a failed or cancelled task back in the queue with a fresh set
+// of retries, keeping its ID and attempt history. It resumes from its last
+// checkpoint, unless a non-nil payload replaces the stored one. Tasks
+// downstream of it that failed because it did are queued again too.
+func (q *Queue) Retry(id string, payload json.RawMessage) (*Task, error) {
+	if payload != nil && !json.Valid(payload) {
+		return nil, fmt.Errorf("payload is not valid JSON")
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	task, err := scanTask(tx.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("task %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != StatusFailed && task.Status != StatusCancelled {
+		return nil, fmt.Errorf("task %s is %s, only failed or cancelled tasks can be retried", id, task.Status)
+	}
+	for _, dep := range task.DependsOn {
+		var status TaskStatus
+		if err := tx.QueryRow(`SELECT status FROM tasks WHERE id = ?`, dep).Scan(&status); err == nil && (status == StatusFailed || status == StatusCancelled) {
+			return nil, fmt.Errorf("dependency %s is %s, retry it instead", dep, status)
+		}
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE tasks SET
+			status = 'pending',
+			payload = COALESCE(?, payload),
+			checkpoint = CASE WHEN ? IS NULL THEN checkpoint END,
+			error = NULL,
+			result = NULL,
+			started_at = NULL,
+			finished_at = NULL,
+			next_attempt_at = NULL,
+			retry_count = 0,
+			ready_at = ?,
+			lease_id = NULL,
+			lease_until = NULL
+		WHERE id = ?
+	`, nullString(string(payload)), nullString(string(payload)), now.UnixMilli(), id)
+	if err != nil {
+		return nil, fmt.Errorf("requeue task: %w", err)
+	}
+
+	// Revive the rest of the job that failed or was cancelled along with
+	// this task
+	rows, err := tx.Query(`
+		WITH RECURSIVE downstream(id) AS (
+			SELECT t.id FROM tasks t, json_each(t.depends_on) d
+			WHERE t.depends_on IS NOT NULL AND d.value = ?
+			UNION
+			SELECT t.id FROM tasks t, json_each(t.depends_on) d
+			JOIN downstream ds ON d.value = ds.id
+			WHERE t.depends_on IS NOT NULL
+		)
+		UPDATE tasks SET status = 'pending', error = NULL, finished_at = NULL, retry_count = 0, ready_at = ?
+		WHERE id IN (SELECT id FROM downstream) AND status IN ('failed', 'cancelled') AND error LIKE 'dependency %'
+		RETURNING id
+	`, id, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("requeue dependents: %w", err)
+	}
+	var revived []string
+	for rows.Next() {
+		var rid string
+		if err := rows.Scan(&rid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		revived = append(revived, rid)
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	for _, rid := range append([]string{id}, revived...) {
+		if t, err := q.GetTask(rid); err == nil && t != nil {
+			q.publish(t)
+			if rid == id {
+				task = t
+			}
+		}
+	}
+	q.wake.broadcast()
+
+	logging.Info("task %s retried (%d dependents requeued)", id, len(revived))
+	return task, nil
+}
+
+// RetryFailed retries every failed task matching filter, except those that
+// failed only because a dependency did: retrying the dependency requeues
+// them. It returns the retried tasks.
+func (q *Queue) RetryFailed(filter RetryFilter) ([]*Task, error) {
+	cond := `status = 'failed' AND ` + depsMet
+	var args []any
+	if len(filter.Types) > 0 {
+		cond += ` AND type IN (` + placeholders(len(filter.Types)) + `)`
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	if !filter.Since.IsZero() {
+		cond += ` AND finished_at >= ?`
+		args = append(args, filter.Since.Local())
+	}
+	if !filter.Until.IsZero() {
+		cond += ` AND finished_at < ?`
+		args = append(args, filter.Until.Local())
+	}
+
+	rows, err := q.db.Query(`SELECT id FROM tasks WHERE `+cond+` ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed tasks: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	retried := []*Task{}
+	for _, id := range ids {
+		t, err := q.Retry(id, nil)
+		if err != nil {
+			logging.Warn("retry task %s: %v", id, err)
+			continue
+		}
+		retried = append(retried, t)
+	}
+	return retried, nil
+}
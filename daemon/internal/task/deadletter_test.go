@@ -0,0 +1,180 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterKeepsAttempts(t *testing.T) {
+	q := newTestQueue(t)
+
+	calls := 0
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		calls++
+		return nil, fmt.Errorf("attempt %d failed", calls)
+	})
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	failed, err := q.EnqueueAndWait(ctx, TaskFileClassify, json.RawMessage(`{"path":"/a"}`), PriorityInteractive)
+	if err == nil {
+		t.Fatal("expected the task to fail")
+	}
+
+	page, err := q.DeadLetters(TaskQuery{})
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].ID != failed.ID {
+		t.Fatalf("expected the failed task, got %+v", page.Tasks)
+	}
+	dl := page.Tasks[0]
+	if string(dl.Payload) != `{"path":"/a"}` || dl.Error != "attempt 3 failed" {
+		t.Errorf("expected payload and last error kept, got %s / %q", dl.Payload, dl.Error)
+	}
+	if len(dl.Attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %+v", dl.Attempts)
+	}
+	for i, a := range dl.Attempts {
+		if a.Attempt != i+1 || a.Status != StatusFailed || a.Error != fmt.Sprintf("attempt %d failed", i+1) {
+			t.Errorf("unexpected attempt %d: %+v", i, a)
+		}
+	}
+}
+
+func TestRetryWithEditedPayload(t *testing.T) {
+	q := newTestQueue(t)
+
+	var got string
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		got = string(payload)
+		if got == `{"path":"/bad"}` {
+			return nil, Permanent(fmt.Errorf("bad path"))
+		}
+		return json.RawMessage(`{}`), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	failed, _ := q.EnqueueAndWait(ctx, TaskFileClassify, json.RawMessage(`{"path":"/bad"}`), PriorityInteractive)
+
+	if _, err := q.Retry(failed.ID, json.RawMessage(`{not json`)); err == nil {
+		t.Error("expected invalid payload to be rejected")
+	}
+	retried, err := q.Retry(failed.ID, json.RawMessage(`{"path":"/good"}`))
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if retried.ID != failed.ID || retried.Status != StatusPending || retried.RetryCount != 0 {
+		t.Errorf("expected task requeued in place, got %+v", retried)
+	}
+
+	done, err := q.Wait(ctx, failed.ID)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if done.Status != StatusCompleted || got != `{"path":"/good"}` {
+		t.Errorf("expected completion with the edited payload, got %s with %s", done.Status, got)
+	}
+
+	attempts, _ := q.Attempts(failed.ID)
+	if len(attempts) != 2 || attempts[0].Status != StatusFailed || attempts[1].Status != StatusCompleted {
+		t.Errorf("expected failed then completed attempts, got %+v", attempts)
+	}
+
+	if _, err := q.Retry(failed.ID, nil); err == nil {
+		t.Error("expected a completed task not to be retried")
+	}
+}
+
+func TestRetryRequeuesFailedDependents(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	last, err := q.EnqueueJob([]JobStep{
+		{Type: TaskFileClassify},
+		{Type: TaskFileRename, DependsOn: []int{0}},
+	}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	tasks, _ := q.JobTasks(last.JobID)
+	root, _ := q.claim(scope{})
+	q.failTask(root, Permanent(fmt.Errorf("boom")))
+
+	if _, err := q.Retry(last.ID, nil); err == nil {
+		t.Error("expected retrying a task with a failed dependency to be refused")
+	}
+	if _, err := q.Retry(tasks[0].ID, nil); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	child, _ := q.GetTask(last.ID)
+	if child.Status != StatusPending || child.Error != "" {
+		t.Errorf("expected dependent requeued, got %s: %s", child.Status, child.Error)
+	}
+}
+
+func TestRetryFailedFilters(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	fail := func(taskType TaskType, age time.Duration) *Task {
+		task, _ := q.Enqueue(taskType, json.RawMessage(`{}`), 0)
+		at := time.Now().Add(-age)
+		q.db.Exec(`UPDATE tasks SET status = 'failed', error = 'x', finished_at = ? WHERE id = ?`, at, task.ID)
+		return task
+	}
+	recent := fail(TaskFileClassify, time.Minute)
+	fail(TaskFileClassify, 48*time.Hour)
+	fail(TaskFileRename, time.Minute)
+
+	retried, err := q.RetryFailed(RetryFilter{
+		Types: []TaskType{TaskFileClassify},
+		Since: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("RetryFailed: %v", err)
+	}
+	if len(retried) != 1 || retried[0].ID != recent.ID {
+		t.Errorf("expected only %s retried, got %+v", recent.ID, retried)
+	}
+
+	page, _ := q.DeadLetters(TaskQuery{})
+	if len(page.Tasks) != 2 {
+		t.Errorf("expected 2 tasks left in the dead letters, got %d", len(page.Tasks))
+	}
+}
+
+func TestPruneKeepsFailedPayloads(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	failed := finishedTask(t, q, StatusFailed, 48*time.Hour)
+	q.recordAttempt(failed, fmt.Errorf("boom"))
+	old := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	q.recordAttempt(old, nil)
+
+	res, err := q.Prune(Retention{ScrubAfter: 24 * time.Hour, StatusMaxAge: map[TaskStatus]time.Duration{StatusCompleted: 24 * time.Hour}}, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Scrubbed != 0 || res.Deleted != 1 {
+		t.Errorf("expected 1 deleted and nothing scrubbed, got %+v", res)
+	}
+	if got, _ := q.GetTask(failed.ID); got == nil || got.Payload == nil {
+		t.Error("failed task should keep its payload")
+	}
+
+	var n int
+	q.db.QueryRow(`SELECT COUNT(*) FROM task_attempts WHERE task_id = ?`, old.ID).Scan(&n)
+	if n != 0 {
+		t.Errorf("expected attempts of the deleted task to go, %d left", n)
+	}
+}
@@ -0,0 +1,138 @@
+package task
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is published whenever a task changes state
+type Event struct {
+	TaskID string     `json:"task_id"`
+	Type   TaskType   `json:"type"`
+	Status TaskStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	// Progress is the latest progress the task's handler reported, if any
+	Progress *Progress `json:"progress,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Done reports whether the task has reached a final state
+func (e Event) Done() bool {
+	return isFinal(e.Status)
+}
+
+func isFinal(status TaskStatus) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusCancelled
+}
+
+// bus fans task events out to subscribers and wakes callers waiting for a
+// particular task to finish. Subscribers that fall behind miss events;
+// waiters never do.
+type bus struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	waiters map[string]map[chan struct{}]struct{}
+	closed  bool
+}
+
+func newBus() *bus {
+	return &bus{
+		subs:    make(map[chan Event]struct{}),
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+func (b *bus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+
+	if ev.Done() {
+		for ch := range b.waiters[ev.TaskID] {
+			close(ch)
+		}
+		delete(b.waiters, ev.TaskID)
+	}
+}
+
+// subscribe returns a channel of events and a function to stop receiving
+// them. The channel is closed when the bus shuts down.
+func (b *bus) subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// wait returns a channel closed once task id finishes, and a function to
+// give up waiting
+func (b *bus) wait(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.waiters[id] == nil {
+		b.waiters[id] = make(map[chan struct{}]struct{})
+	}
+	b.waiters[id][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if set, ok := b.waiters[id]; ok {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(b.waiters, id)
+			}
+		}
+	}
+}
+
+// close ends all subscriptions
+func (b *bus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = make(map[chan Event]struct{})
+}
+
+// Subscribe streams task state changes to the caller until the returned
+// function is called or the queue stops. Events are dropped for a
+// subscriber whose buffer is full.
+func (q *Queue) Subscribe(buffer int) (<-chan Event, func()) {
+	return q.events.subscribe(buffer)
+}
+
+func (q *Queue) publish(task *Task) {
+	q.events.publish(Event{
+		TaskID:   task.ID,
+		Type:     task.Type,
+		Status:   task.Status,
+		Error:    task.Error,
+		Progress: task.Progress,
+		Time:     time.Now(),
+	})
+}
@@ -0,0 +1,203 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/bender/internal/logging"
+)
+
+const jobIDKey contextKey = "jobID"
+
+// JobIDFromContext extracts the job ID from a context, if the task belongs
+// to one.
+func JobIDFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(jobIDKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// depsMet is the claim condition for tasks with dependencies: every parent
+// must have completed
+const depsMet = `(depends_on IS NULL OR NOT EXISTS (
+	SELECT 1 FROM json_each(tasks.depends_on) d JOIN tasks p ON p.id = d.value
+	WHERE p.status != 'completed'
+))`
+
+// JobStep is one task in a job. DependsOn holds indexes of earlier steps.
+type JobStep struct {
+	Type      TaskType
+	Payload   json.RawMessage
+	DependsOn []int
+}
+
+// EnqueueJob adds a graph of tasks sharing one job ID and returns the last
+// step, which is expected to depend on the rest. Each step runs only after
+// its parents complete, receives their results merged into its payload, and
+// is retried on its own; if a step fails, the steps downstream of it fail
+// too. A DedupeKey applies to the last step: if it matches, the existing
+// task is returned and nothing is enqueued. RejectIfPaused applies to the
+// whole job.
+func (q *Queue) EnqueueJob(steps []JobStep, opts EnqueueOptions) (*Task, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("job has no steps")
+	}
+	for i, step := range steps {
+		for _, dep := range step.DependsOn {
+			if dep < 0 || dep >= i {
+				return nil, fmt.Errorf("step %d: dependency %d must be an earlier step", i, dep)
+			}
+		}
+	}
+
+	if opts.RejectIfPaused {
+		unlock, err := q.holdUnpaused()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	last := steps[len(steps)-1]
+	if opts.DedupeKey != "" {
+		existing, err := q.findDuplicate(tx, last.Type, opts.DedupeKey)
+		if err != nil {
+			return nil, fmt.Errorf("find duplicate: %w", err)
+		}
+		if existing != nil {
+			logging.Debug("job for %s %q merged into %s task %s", last.Type, opts.DedupeKey, existing.Status, existing.ID)
+			return existing, nil
+		}
+	}
+
+	if err := q.checkCapacity(tx); err != nil {
+		return nil, err
+	}
+
+	jobID := generateID()
+	tasks := make([]*Task, len(steps))
+	for i, step := range steps {
+		stepOpts := EnqueueOptions{Priority: opts.Priority, JobID: jobID}
+		for _, dep := range step.DependsOn {
+			stepOpts.DependsOn = append(stepOpts.DependsOn, tasks[dep].ID)
+		}
+		if i == len(steps)-1 {
+			stepOpts.DedupeKey = opts.DedupeKey
+		}
+		if tasks[i], err = q.insert(tx, step.Type, step.Payload, stepOpts); err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i, step.Type, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	for _, t := range tasks {
+		q.publish(t)
+	}
+	q.wake.broadcast()
+
+	logging.Debug("job %s enqueued: %d steps", jobID, len(steps))
+	return tasks[len(tasks)-1], nil
+}
+
+// JobTasks returns the tasks of a job in the order they were enqueued
+func (q *Queue) JobTasks(jobID string) ([]*Task, error) {
+	rows, err := q.db.Query(`SELECT `+taskColumns+` FROM tasks WHERE job_id = ? ORDER BY created_at ASC, id ASC`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// input builds the payload a task's handler receives: the results of its
+// parents, merged in order, overlaid with the task's own payload. Results
+// and payloads that are not JSON objects are skipped when merging.
+func (q *Queue) input(task *Task) (json.RawMessage, error) {
+	if len(task.DependsOn) == 0 {
+		return task.Payload, nil
+	}
+
+	merged := make(map[string]json.RawMessage)
+	for _, id := range task.DependsOn {
+		parent, err := q.GetTask(id)
+		if err != nil {
+			return nil, fmt.Errorf("load dependency %s: %w", id, err)
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("dependency %s not found", id)
+		}
+		mergeObject(merged, parent.Result)
+	}
+	mergeObject(merged, task.Payload)
+	return json.Marshal(merged)
+}
+
+func mergeObject(dst map[string]json.RawMessage, raw json.RawMessage) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		return
+	}
+	for k, v := range obj {
+		dst[k] = v
+	}
+}
+
+// failDependents marks every pending task downstream of id with status,
+// so a failed or cancelled step does not leave the rest of its job waiting
+// forever
+func (q *Queue) failDependents(id string, status TaskStatus, reason string) {
+	now := time.Now()
+	rows, err := q.db.Query(`
+		WITH RECURSIVE downstream(id) AS (
+			SELECT t.id FROM tasks t, json_each(t.depends_on) d
+			WHERE t.depends_on IS NOT NULL AND d.value = ?
+			UNION
+			SELECT t.id FROM tasks t, json_each(t.depends_on) d
+			JOIN downstream ds ON d.value = ds.id
+			WHERE t.depends_on IS NOT NULL
+		)
+		UPDATE tasks SET status = ?, error = ?, finished_at = ?, next_attempt_at = NULL
+		WHERE id IN (SELECT id FROM downstream) AND status = 'pending'
+		RETURNING id, type
+	`, id, status, reason, now)
+	if err != nil {
+		logging.Error("failed to propagate %s of task %s: %v", status, id, err)
+		return
+	}
+
+	var affected []*Task
+	for rows.Next() {
+		t := &Task{Status: status, Error: reason, FinishedAt: &now}
+		if err := rows.Scan(&t.ID, &t.Type); err != nil {
+			logging.Error("failed to propagate %s of task %s: %v", status, id, err)
+			break
+		}
+		affected = append(affected, t)
+	}
+	rows.Close()
+
+	for _, t := range affected {
+		logging.Debug("task %s %s: %s", t.ID, status, reason)
+		q.publish(t)
+	}
+}
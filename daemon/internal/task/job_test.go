@@ -0,0 +1,229 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaimWaitsForDependencies(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	parent, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	child, err := q.EnqueueWith(TaskFileRename, json.RawMessage(`{}`), EnqueueOptions{Priority: PriorityInteractive, DependsOn: []string{parent.ID}})
+	if err != nil {
+		t.Fatalf("EnqueueWith: %v", err)
+	}
+
+	// The child has the higher priority but must wait for its parent
+	claimed, _ := q.claim(scope{})
+	if claimed == nil || claimed.ID != parent.ID {
+		t.Fatalf("expected parent to be claimed first, got %+v", claimed)
+	}
+	if next, _ := q.claim(scope{}); next != nil {
+		t.Fatalf("expected child to wait for its parent, claimed %s", next.ID)
+	}
+
+	claimed.Status = StatusCompleted
+	q.updateTask(claimed)
+	next, _ := q.claim(scope{})
+	if next == nil || next.ID != child.ID {
+		t.Fatalf("expected child after parent completed, got %+v", next)
+	}
+	if len(next.DependsOn) != 1 || next.DependsOn[0] != parent.ID {
+		t.Errorf("expected depends_on [%s], got %v", parent.ID, next.DependsOn)
+	}
+}
+
+func TestEnqueueUnknownDependency(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	_, err := q.EnqueueWith(TaskFileRename, nil, EnqueueOptions{DependsOn: []string{"missing"}})
+	if err == nil {
+		t.Fatal("expected error for unknown dependency")
+	}
+}
+
+func TestJobResultsFlowToDependents(t *testing.T) {
+	q := newTestQueue(t)
+
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{"category":"docs","path":"/a"}`), nil
+	})
+	var got map[string]string
+	var jobID string
+	q.RegisterHandler(TaskFileRename, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		json.Unmarshal(payload, &got)
+		jobID = JobIDFromContext(ctx)
+		return json.RawMessage(`{}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	last, err := q.EnqueueJob([]JobStep{
+		{Type: TaskFileClassify, Payload: json.RawMessage(`{"path":"/a"}`)},
+		{Type: TaskFileRename, Payload: json.RawMessage(`{"path":"/b"}`), DependsOn: []int{0}},
+	}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := q.Wait(ctx, last.ID); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// The task's own payload wins over its parent's result
+	if got["category"] != "docs" || got["path"] != "/b" {
+		t.Errorf("unexpected merged payload: %v", got)
+	}
+	if jobID == "" || jobID != last.JobID {
+		t.Errorf("expected job ID %q in context, got %q", last.JobID, jobID)
+	}
+
+	tasks, err := q.JobTasks(last.JobID)
+	if err != nil {
+		t.Fatalf("JobTasks: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Type != TaskFileClassify || tasks[1].ID != last.ID {
+		t.Errorf("unexpected job tasks: %+v", tasks)
+	}
+}
+
+func TestJobFailurePropagates(t *testing.T) {
+	q := newTestQueue(t)
+
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return nil, Permanent(fmt.Errorf("unreadable"))
+	})
+	ran := false
+	q.RegisterHandler(TaskFileRename, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		ran = true
+		return nil, nil
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	last, err := q.EnqueueJob([]JobStep{
+		{Type: TaskFileClassify},
+		{Type: TaskFileRename, DependsOn: []int{0}},
+		{Type: TaskFileRename, DependsOn: []int{1}},
+	}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.Wait(ctx, last.ID)
+	if err == nil {
+		t.Fatal("expected job to fail")
+	}
+	if result.Status != StatusFailed || !strings.Contains(result.Error, "unreadable") {
+		t.Errorf("expected failure naming the cause, got %s: %s", result.Status, result.Error)
+	}
+	if ran {
+		t.Error("dependent step should not run")
+	}
+
+	tasks, _ := q.JobTasks(last.JobID)
+	for _, task := range tasks {
+		if task.Status != StatusFailed {
+			t.Errorf("task %s (%s): expected failed, got %s", task.ID, task.Type, task.Status)
+		}
+	}
+}
+
+func TestCancelPropagatesToDependents(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	last, err := q.EnqueueJob([]JobStep{
+		{Type: TaskFileClassify},
+		{Type: TaskFileRename, DependsOn: []int{0}},
+	}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	tasks, _ := q.JobTasks(last.JobID)
+	if err := q.CancelTask(tasks[0].ID); err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+
+	child, _ := q.GetTask(last.ID)
+	if child.Status != StatusCancelled {
+		t.Errorf("expected dependent to be cancelled, got %s", child.Status)
+	}
+	if _, err := q.EnqueueWith(TaskFileRename, nil, EnqueueOptions{DependsOn: []string{tasks[0].ID}}); err == nil {
+		t.Error("expected error depending on a cancelled task")
+	}
+}
+
+func TestEnqueueJobDedupe(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	steps := []JobStep{
+		{Type: TaskFileClassify},
+		{Type: TaskPipelineAutoFile, DependsOn: []int{0}},
+	}
+	first, err := q.EnqueueJob(steps, EnqueueOptions{DedupeKey: "/tmp/a.zip"})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	second, err := q.EnqueueJob(steps, EnqueueOptions{DedupeKey: "/tmp/a.zip"})
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected duplicate job to return %s, got %s", first.ID, second.ID)
+	}
+
+	all, _ := q.ListTasks(10)
+	if len(all) != 2 {
+		t.Errorf("expected 2 tasks, got %d", len(all))
+	}
+}
+
+func TestEnqueueJobRejectsForwardDependency(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	_, err := q.EnqueueJob([]JobStep{
+		{Type: TaskFileClassify, DependsOn: []int{1}},
+		{Type: TaskFileRename},
+	}, EnqueueOptions{})
+	if err == nil {
+		t.Fatal("expected error for dependency on a later step")
+	}
+}
+
+func TestEnqueueJobRejectIfPaused(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	steps := []JobStep{
+		{Type: TaskFileClassify},
+		{Type: TaskFileRename, DependsOn: []int{0}},
+	}
+	q.Pause()
+	if _, err := q.EnqueueJob(steps, EnqueueOptions{RejectIfPaused: true}); err != ErrQueuePaused {
+		t.Fatalf("expected ErrQueuePaused, got %v", err)
+	}
+	if all, _ := q.ListTasks(10); len(all) != 0 {
+		t.Errorf("expected nothing enqueued while paused, got %d tasks", len(all))
+	}
+
+	q.Resume()
+	if _, err := q.EnqueueJob(steps, EnqueueOptions{RejectIfPaused: true}); err != nil {
+		t.Fatalf("EnqueueJob after resume: %v", err)
+	}
+}
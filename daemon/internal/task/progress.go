@@ -0,0 +1,62 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/user/bender/internal/logging"
+)
+
+const progressKey contextKey = "progress"
+
+// Progress is how far a running task has got, as its handler last reported
+type Progress struct {
+	Step      string    `json:"step,omitempty"`
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Reporter records progress for the task a handler is running
+type Reporter struct {
+	q    *Queue
+	task *Task
+}
+
+// ProgressFromContext returns the progress reporter of the running task.
+// Outside a task it returns nil, whose Report does nothing.
+func ProgressFromContext(ctx context.Context) *Reporter {
+	r, _ := ctx.Value(progressKey).(*Reporter)
+	return r
+}
+
+// Report saves the task's progress on its row and publishes it to
+// subscribers. Percent is clamped to 0-100. Progress is best effort:
+// failures are logged, not returned.
+func (r *Reporter) Report(step string, percent int, message string) {
+	if r == nil {
+		return
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	p := &Progress{Step: step, Percent: percent, Message: message, UpdatedAt: time.Now()}
+	raw, _ := json.Marshal(p)
+
+	res, err := r.q.db.Exec(`
+		UPDATE tasks SET progress = ? WHERE id = ? AND status = 'running' AND lease_id = ?
+	`, string(raw), r.task.ID, r.task.lease)
+	if err != nil {
+		logging.Warn("failed to save progress of task %s: %v", r.task.ID, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	r.task.Progress = p
+	r.q.publish(r.task)
+}
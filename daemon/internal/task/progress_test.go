@@ -0,0 +1,70 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReportProgress(t *testing.T) {
+	q := newTestQueue(t)
+
+	release := make(chan struct{})
+	reported := make(chan struct{})
+	q.RegisterHandler(TaskPipelineScreenshot, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		ProgressFromContext(ctx).Report("tag", 150, "tagging")
+		close(reported)
+		<-release
+		return json.RawMessage(`{}`), nil
+	})
+
+	events, unsubscribe := q.Subscribe(16)
+	defer unsubscribe()
+	q.Start()
+	defer q.Stop()
+
+	task, _ := q.Enqueue(TaskPipelineScreenshot, json.RawMessage(`{}`), PriorityInteractive)
+	<-reported
+
+	running, _ := q.GetTask(task.ID)
+	if running.Progress == nil || running.Progress.Step != "tag" || running.Progress.Percent != 100 || running.Progress.Message != "tagging" {
+		t.Errorf("expected clamped progress on the task, got %+v", running.Progress)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.TaskID == task.ID && ev.Progress != nil {
+				if ev.Status != StatusRunning || ev.Progress.Step != "tag" {
+					t.Errorf("unexpected progress event %+v", ev)
+				}
+				close(release)
+				return
+			}
+		case <-timeout:
+			close(release)
+			t.Fatal("no progress event published")
+		}
+	}
+}
+
+func TestProgressOutsideTask(t *testing.T) {
+	// A nil reporter is a no-op
+	ProgressFromContext(context.Background()).Report("step", 50, "")
+}
+
+func TestClaimClearsProgress(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	task, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), 0)
+	q.db.Exec(`UPDATE tasks SET progress = '{"step":"old","percent":50}' WHERE id = ?`, task.ID)
+	q.claim(scope{})
+
+	got, _ := q.GetTask(task.ID)
+	if got.Progress != nil {
+		t.Errorf("expected a new attempt to start without progress, got %+v", got.Progress)
+	}
+}
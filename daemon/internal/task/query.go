@@ -0,0 +1,197 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 500
+)
+
+// TaskQuery selects tasks for QueryTasks. Zero fields do not filter.
+type TaskQuery struct {
+	Types    []TaskType   `json:"types,omitempty"`
+	Statuses []TaskStatus `json:"statuses,omitempty"`
+	JobID    string       `json:"job_id,omitempty"`
+	// Since and Until bound the creation time: Since inclusive, Until
+	// exclusive. Times are stored in local time, so they are converted.
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+	// Search matches a substring of the payload or error, ignoring ASCII case
+	Search string `json:"search,omitempty"`
+	// Limit is the page size, 50 by default and at most 500
+	Limit int `json:"limit,omitempty"`
+	// Cursor continues from a previous page's NextCursor
+	Cursor string `json:"cursor,omitempty"`
+	// Fields, if set, are the JSON fields to return. The payload, result
+	// and checkpoint are only read from the database when listed. The id
+	// is always returned.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// TaskPage is one page of QueryTasks results, newest first
+type TaskPage struct {
+	Tasks      []*Task `json:"tasks"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// cursor marks the last task of a page
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// QueryTasks returns the tasks matching query, newest first, a page at a time
+func (q *Queue) QueryTasks(query TaskQuery) (*TaskPage, error) {
+	var conds []string
+	var args []any
+
+	if len(query.Types) > 0 {
+		conds = append(conds, `type IN (`+placeholders(len(query.Types))+`)`)
+		for _, t := range query.Types {
+			args = append(args, t)
+		}
+	}
+	if len(query.Statuses) > 0 {
+		conds = append(conds, `status IN (`+placeholders(len(query.Statuses))+`)`)
+		for _, s := range query.Statuses {
+			args = append(args, s)
+		}
+	}
+	if query.JobID != "" {
+		conds = append(conds, `job_id = ?`)
+		args = append(args, query.JobID)
+	}
+	if !query.Since.IsZero() {
+		conds = append(conds, `created_at >= ?`)
+		args = append(args, query.Since.Local())
+	}
+	if !query.Until.IsZero() {
+		conds = append(conds, `created_at < ?`)
+		args = append(args, query.Until.Local())
+	}
+	if query.Search != "" {
+		pattern := "%" + escapeLike(query.Search) + "%"
+		conds = append(conds, `(payload LIKE ? ESCAPE '\' OR error LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, `(created_at < ? OR (created_at = ? AND id < ?))`)
+		args = append(args, c.CreatedAt, c.CreatedAt, c.ID)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	columns := taskColumns
+	if len(query.Fields) > 0 {
+		if !hasField(query.Fields, "payload") {
+			columns = strings.Replace(columns, "payload", "NULL", 1)
+		}
+		if !hasField(query.Fields, "result") {
+			columns = strings.Replace(columns, "result", "NULL", 1)
+		}
+		if !hasField(query.Fields, "checkpoint") {
+			columns = strings.Replace(columns, "checkpoint", "NULL", 1)
+		}
+	}
+
+	stmt := `SELECT ` + columns + ` FROM tasks`
+	if len(conds) > 0 {
+		stmt += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	// One extra row tells whether there is another page
+	stmt += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := q.db.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+	defer rows.Close()
+
+	page := &TaskPage{Tasks: []*Task{}}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Tasks = append(page.Tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Tasks) > limit {
+		page.Tasks = page.Tasks[:limit]
+		last := page.Tasks[limit-1]
+		page.NextCursor = encodeCursor(cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// Project returns the task as a JSON object holding only the given fields
+// and its id
+func (t *Task) Project(fields []string) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+	out := map[string]json.RawMessage{"id": all["id"]}
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			out[f] = v
+		}
+	}
+	return out, nil
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &c) != nil || c.ID == "" {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+func hasField(fields []string, name string) bool {
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
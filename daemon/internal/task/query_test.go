@@ -0,0 +1,118 @@
+package task
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQueryTasksFilters(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	a, _ := q.Enqueue(TaskClipboardSummarize, json.RawMessage(`{"content":"Quarterly Report"}`), 0)
+	b, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{"path":"/tmp/100%_done.pdf"}`), 0)
+	c, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{"path":"/tmp/other.pdf"}`), 0)
+	q.db.Exec(`UPDATE tasks SET status = 'failed', error = 'model timeout' WHERE id = ?`, c.ID)
+
+	tests := []struct {
+		name  string
+		query TaskQuery
+		want  []string
+	}{
+		{"all", TaskQuery{}, []string{c.ID, b.ID, a.ID}},
+		{"type", TaskQuery{Types: []TaskType{TaskFileClassify}}, []string{c.ID, b.ID}},
+		{"status", TaskQuery{Statuses: []TaskStatus{StatusFailed}}, []string{c.ID}},
+		{"statuses", TaskQuery{Statuses: []TaskStatus{StatusPending, StatusFailed}}, []string{c.ID, b.ID, a.ID}},
+		{"search payload", TaskQuery{Search: "quarterly"}, []string{a.ID}},
+		{"search error", TaskQuery{Search: "timeout"}, []string{c.ID}},
+		{"search escapes wildcards", TaskQuery{Search: "100%_"}, []string{b.ID}},
+		{"since", TaskQuery{Since: time.Now().Add(time.Hour)}, nil},
+		{"until", TaskQuery{Until: time.Now().Add(time.Hour).UTC()}, []string{c.ID, b.ID, a.ID}},
+	}
+	for _, tt := range tests {
+		page, err := q.QueryTasks(tt.query)
+		if err != nil {
+			t.Fatalf("%s: QueryTasks: %v", tt.name, err)
+		}
+		var got []string
+		for _, task := range page.Tasks {
+			got = append(got, task.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestQueryTasksPagination(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		task, _ := q.Enqueue(TaskClipboardSummarize, nil, 0)
+		ids = append([]string{task.ID}, ids...)
+	}
+
+	var got []string
+	query := TaskQuery{Limit: 2}
+	pages := 0
+	for {
+		page, err := q.QueryTasks(query)
+		if err != nil {
+			t.Fatalf("QueryTasks: %v", err)
+		}
+		pages++
+		for _, task := range page.Tasks {
+			got = append(got, task.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if pages != 3 || len(got) != 5 {
+		t.Fatalf("expected 5 tasks over 3 pages, got %d over %d", len(got), pages)
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Fatalf("expected %v, got %v", ids, got)
+		}
+	}
+
+	if _, err := q.QueryTasks(TaskQuery{Cursor: "garbage"}); err == nil {
+		t.Error("expected error for an invalid cursor")
+	}
+}
+
+func TestQueryTasksProjection(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	q.Enqueue(TaskClipboardSummarize, json.RawMessage(`{"content":"big"}`), 0)
+
+	page, err := q.QueryTasks(TaskQuery{Fields: []string{"type", "status"}})
+	if err != nil {
+		t.Fatalf("QueryTasks: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].Payload != nil {
+		t.Fatalf("expected payload to be left out, got %+v", page.Tasks)
+	}
+
+	projected, err := page.Tasks[0].Project([]string{"type", "status"})
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	if len(projected) != 3 || string(projected["type"]) != `"clipboard.summarize"` || projected["id"] == nil {
+		t.Errorf("unexpected projection: %v", projected)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -23,6 +25,16 @@ const (
 	TaskScreenshotTag      TaskType = "screenshot.tag"
 	TaskPipelineAutoFile   TaskType = "pipeline.auto_file"
 	TaskPipelineScreenshot TaskType = "pipeline.screenshot"
+
+	// Steps of the auto-file job that TaskPipelineAutoFile expands into
+	TaskAutoFileClassify TaskType = "auto_file.classify"
+	TaskAutoFileMove     TaskType = "auto_file.move"
+	TaskAutoFileRename   TaskType = "auto_file.rename"
+	TaskAutoFileFinish   TaskType = "auto_file.finish"
+
+	// Maintenance tasks, usually run on a schedule
+	TaskAutoFileSweep TaskType = "auto_file.sweep"
+	TaskUndoCleanup   TaskType = "undo.cleanup"
 )
 
 // TaskStatus represents the status of a task
@@ -33,12 +45,27 @@ const (
 	StatusRunning   TaskStatus = "running"
 	StatusCompleted TaskStatus = "completed"
 	StatusFailed    TaskStatus = "failed"
+	StatusCancelled TaskStatus = "cancelled"
+)
+
+var (
+	// ErrTaskCancelled is returned by EnqueueAndWait when the task is cancelled
+	ErrTaskCancelled = errors.New("task cancelled")
+	// ErrQueueFull is returned by Enqueue when MaxPending tasks are waiting
+	ErrQueueFull = errors.New("task queue full")
+	// ErrQueuePaused is returned by EnqueueAndWait, and by enqueues with
+	// RejectIfPaused set, while the queue is paused, rather than blocking
+	// until it is resumed
+	ErrQueuePaused = errors.New("queue paused")
 )
 
 // contextKey is an unexported type for context keys in this package.
 type contextKey string
 
-const taskIDKey contextKey = "taskID"
+const (
+	taskIDKey   contextKey = "taskID"
+	taskTypeKey contextKey = "taskType"
+)
 
 // TaskIDFromContext extracts the task ID from a context, if present.
 func TaskIDFromContext(ctx context.Context) string {
@@ -48,6 +75,15 @@ func TaskIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// TaskTypeFromContext extracts the type of the running task from a
+// context, if present.
+func TaskTypeFromContext(ctx context.Context) TaskType {
+	if v, ok := ctx.Value(taskTypeKey).(TaskType); ok {
+		return v
+	}
+	return ""
+}
+
 // Task represents a queued task
 type Task struct {
 	ID         string          `json:"id"`
@@ -62,6 +98,17 @@ type Task struct {
 	FinishedAt *time.Time      `json:"finished_at,omitempty"`
 	RetryCount int             `json:"retry_count"`
 	MaxRetries int             `json:"max_retries"`
+	// NextAttemptAt is when a pending retry is scheduled to run
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DedupeKey     string     `json:"dedupe_key,omitempty"`
+	JobID         string     `json:"job_id,omitempty"`
+	DependsOn     []string   `json:"depends_on,omitempty"`
+	// Checkpoint is the progress the handler last saved with Checkpoint
+	Checkpoint json.RawMessage `json:"checkpoint,omitempty"`
+	// Progress is the latest report of the current or last attempt
+	Progress *Progress `json:"progress,omitempty"`
+
+	lease string // set while this process holds the task
 }
 
 // Handler processes a task and returns a result
@@ -69,26 +116,76 @@ type Handler func(ctx context.Context, payload json.RawMessage) (json.RawMessage
 
 // Queue manages task execution
 type Queue struct {
-	db           *sql.DB
-	handlers     map[TaskType]Handler
-	tasks        chan *Task
-	maxWorkers   int
-	maxRetries   int
-	retryDelay   time.Duration
-	taskTimeout  time.Duration
-	mu           sync.RWMutex
-	wg           sync.WaitGroup
-	ctx          context.Context
-	cancel       context.CancelFunc
+	db          *sql.DB
+	handlers    map[TaskType]Handler
+	running     map[string]context.CancelFunc
+	wake        *signal
+	events      *bus
+	maxWorkers  int
+	reserved    int
+	maxPending  int
+	dedupe      time.Duration
+	aging       time.Duration
+	maxRetries  int
+	retryDelay  time.Duration
+	maxDelay    time.Duration
+	taskTimeout time.Duration
+	leaseTime   time.Duration
+	types       map[TaskType]TypeConfig
+	retention   Retention
+	pruneEvery  time.Duration
+	pruneHooks  []func(PruneResult)
+	paused      atomic.Bool
+	pauseMu     sync.RWMutex // orders Pause against RejectIfPaused enqueues
+	drainTime   time.Duration
+	drain       chan struct{} // closed when Stop begins
+	stopOnce    sync.Once
+	mu          sync.RWMutex
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 // Config for the task queue
 type Config struct {
-	DBPath        string
-	MaxWorkers    int
-	MaxRetries    int
-	RetryDelay    time.Duration
-	TaskTimeout   time.Duration
+	DBPath      string
+	MaxWorkers  int
+	MaxRetries  int
+	RetryDelay  time.Duration // first retry delay, doubled on each attempt
+	MaxDelay    time.Duration // cap on the retry delay
+	TaskTimeout time.Duration
+	// ReservedWorkers of MaxWorkers only run interactive tasks. At least
+	// one worker is always left for background work.
+	ReservedWorkers int
+	// Aging is how long a task waits to gain one priority level. Zero
+	// means one minute; a negative value disables aging, so priority is
+	// strict.
+	Aging time.Duration
+	// MaxPending makes Enqueue fail once this many tasks are waiting.
+	// Zero means unbounded.
+	MaxPending int
+	// DedupeWindow is how long a completed task still absorbs new tasks
+	// with the same dedupe key. Zero only merges into unfinished tasks.
+	DedupeWindow time.Duration
+	// Types overrides settings for particular task types
+	Types map[TaskType]TypeConfig
+	// Retention is enforced by a janitor every PruneInterval. Zero
+	// disables the janitor.
+	Retention     Retention
+	PruneInterval time.Duration
+	// DrainTimeout is how long Stop lets running tasks finish before
+	// cancelling them. Zero cancels them at once.
+	DrainTimeout time.Duration
+}
+
+// TypeConfig overrides queue settings for one task type. A zero Timeout
+// or nil MaxRetries uses the queue's default.
+type TypeConfig struct {
+	Timeout    time.Duration
+	MaxRetries *int
+	// Workers gives the type a pool of its own: that many workers run only
+	// this type, and the shared workers never do
+	Workers int
 }
 
 // NewQueue creates a new task queue
@@ -102,15 +199,34 @@ func NewQueue(cfg Config) (*Queue, error) {
 	if cfg.RetryDelay == 0 {
 		cfg.RetryDelay = 5 * time.Second
 	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = 5 * time.Minute
+	}
+	if cfg.MaxDelay < cfg.RetryDelay {
+		cfg.MaxDelay = cfg.RetryDelay
+	}
 	if cfg.TaskTimeout == 0 {
 		cfg.TaskTimeout = 30 * time.Second
 	}
+	if cfg.ReservedWorkers > cfg.MaxWorkers-1 {
+		cfg.ReservedWorkers = cfg.MaxWorkers - 1
+	}
+	if cfg.ReservedWorkers < 0 {
+		cfg.ReservedWorkers = 0
+	}
+	if cfg.Aging == 0 {
+		cfg.Aging = time.Minute
+	}
 
 	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
+	// One connection serializes the queue's writes, so concurrent claims
+	// never hit a locked database
+	db.SetMaxOpenConns(1)
+
 	if err := initDB(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("init database: %w", err)
@@ -121,11 +237,24 @@ func NewQueue(cfg Config) (*Queue, error) {
 	q := &Queue{
 		db:          db,
 		handlers:    make(map[TaskType]Handler),
-		tasks:       make(chan *Task, 100),
+		running:     make(map[string]context.CancelFunc),
+		wake:        newSignal(),
+		events:      newBus(),
 		maxWorkers:  cfg.MaxWorkers,
+		reserved:    cfg.ReservedWorkers,
+		maxPending:  cfg.MaxPending,
+		dedupe:      cfg.DedupeWindow,
+		aging:       cfg.Aging,
 		maxRetries:  cfg.MaxRetries,
 		retryDelay:  cfg.RetryDelay,
+		maxDelay:    cfg.MaxDelay,
 		taskTimeout: cfg.TaskTimeout,
+		leaseTime:   leaseTime(cfg),
+		types:       cfg.Types,
+		retention:   cfg.Retention,
+		pruneEvery:  cfg.PruneInterval,
+		drainTime:   cfg.DrainTimeout,
+		drain:       make(chan struct{}),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
@@ -152,7 +281,63 @@ func initDB(db *sql.DB) error {
 		CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
 		CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks(created_at);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+	err = addColumns(db, "tasks", map[string]string{
+		"next_attempt_at": "DATETIME",
+		"ready_at":        "INTEGER DEFAULT 0", // unix ms when the task may next run
+		"lease_id":        "TEXT",
+		"lease_until":     "INTEGER", // unix ms
+		"dedupe_key":      "TEXT",
+		"job_id":          "TEXT",
+		"depends_on":      "TEXT", // JSON array of task IDs
+		"checkpoint":      "TEXT",
+		"progress":        "TEXT", // JSON Progress of the current or last attempt
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_tasks_ready ON tasks(status, ready_at);
+		CREATE INDEX IF NOT EXISTS idx_tasks_dedupe ON tasks(type, dedupe_key) WHERE dedupe_key IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_tasks_job ON tasks(job_id) WHERE job_id IS NOT NULL;
+	`)
+	if err != nil {
+		return err
+	}
+	return initAttempts(db)
+}
+
+// addColumns adds any of columns missing from a table created by an older
+// version of the daemon
+func addColumns(db *sql.DB, table string, columns map[string]string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for name, typ := range columns {
+		if existing[name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, typ)); err != nil {
+			return fmt.Errorf("add column %s: %w", name, err)
+		}
+	}
+	return nil
 }
 
 // RegisterHandler registers a handler for a task type
@@ -162,70 +347,160 @@ func (q *Queue) RegisterHandler(taskType TaskType, handler Handler) {
 	q.mu.Unlock()
 }
 
+// HasHandler reports whether a handler is registered for a task type
+func (q *Queue) HasHandler(taskType TaskType) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	_, ok := q.handlers[taskType]
+	return ok
+}
+
 // Start begins processing tasks
 func (q *Queue) Start() error {
-	// Restart any interrupted tasks
-	if err := q.restartPending(); err != nil {
-		logging.Warn("failed to restart pending tasks: %v", err)
+	// Tasks left running by a previous process go back in line
+	if err := q.recoverInterrupted(); err != nil {
+		logging.Warn("failed to recover interrupted tasks: %v", err)
 	}
 
-	// Start workers
-	for i := 0; i < q.maxWorkers; i++ {
+	// Start the shared workers, the first few reserved for interactive
+	// tasks, then each type's own pool
+	var pooled []TaskType
+	for taskType, tc := range q.types {
+		if tc.Workers > 0 {
+			pooled = append(pooled, taskType)
+		}
+	}
+	id := 0
+	for ; id < q.maxWorkers; id++ {
+		q.wg.Add(1)
+		go q.worker(id, scope{interactiveOnly: id < q.reserved, exclude: pooled})
+	}
+	for _, taskType := range pooled {
+		for i := 0; i < q.types[taskType].Workers; i++ {
+			q.wg.Add(1)
+			go q.worker(id, scope{types: []TaskType{taskType}})
+			id++
+		}
+		logging.Info("task queue: %d workers for %s", q.types[taskType].Workers, taskType)
+	}
+
+	if q.pruneEvery > 0 {
 		q.wg.Add(1)
-		go q.worker(i)
+		go q.janitor(q.pruneEvery)
 	}
 
-	logging.Info("task queue started with %d workers", q.maxWorkers)
+	logging.Info("task queue started with %d workers (%d reserved for interactive tasks)", q.maxWorkers, q.reserved)
 	return nil
 }
 
-// Stop halts task processing
+// Stop halts task processing. Workers stop claiming tasks at once, and
+// running tasks have the drain timeout to finish. Any still running then
+// have their contexts cancelled and go back to pending for the next start,
+// resuming from their last checkpoint.
 func (q *Queue) Stop() error {
-	q.cancel()
-	close(q.tasks)
-	q.wg.Wait()
-	q.db.Close()
-	logging.Info("task queue stopped")
+	q.stopOnce.Do(func() {
+		close(q.drain)
+
+		done := make(chan struct{})
+		go func() {
+			q.wg.Wait()
+			close(done)
+		}()
+		if q.drainTime > 0 {
+			q.mu.RLock()
+			running := len(q.running)
+			q.mu.RUnlock()
+			if running > 0 {
+				logging.Info("task queue: waiting up to %v for %d running tasks", q.drainTime, running)
+			}
+			timer := time.NewTimer(q.drainTime)
+			select {
+			case <-done:
+			case <-timer.C:
+				logging.Warn("task queue: drain timed out, interrupting running tasks")
+			}
+			timer.Stop()
+		}
+		q.cancel()
+		<-done
+
+		q.events.close()
+		q.db.Close()
+		logging.Info("task queue stopped")
+	})
 	return nil
 }
 
-func (q *Queue) restartPending() error {
-	rows, err := q.db.Query(`
-		SELECT id, type, priority, payload, retry_count, max_retries
-		FROM tasks
-		WHERE status IN ('pending', 'running')
-		ORDER BY priority DESC, created_at ASC
+// Pause stops workers from claiming tasks. Running tasks finish, and
+// tasks can still be enqueued.
+func (q *Queue) Pause() {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+	q.paused.Store(true)
+}
+
+// Resume lets workers claim tasks again
+func (q *Queue) Resume() {
+	q.paused.Store(false)
+	q.wake.broadcast()
+}
+
+// Paused reports whether the queue is paused
+func (q *Queue) Paused() bool {
+	return q.paused.Load()
+}
+
+func (q *Queue) recoverInterrupted() error {
+	res, err := q.db.Exec(`
+		UPDATE tasks SET status = 'pending', lease_id = NULL, lease_until = NULL
+		WHERE status = 'running'
 	`)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var task Task
-		if err := rows.Scan(&task.ID, &task.Type, &task.Priority, &task.Payload, &task.RetryCount, &task.MaxRetries); err != nil {
-			continue
-		}
-		select {
-		case q.tasks <- &task:
-		default:
-			logging.Warn("task queue full, dropping task %s", task.ID)
-		}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logging.Info("requeued %d interrupted tasks", n)
 	}
 	return nil
 }
 
-func (q *Queue) worker(id int) {
+func (q *Queue) worker(id int, sc scope) {
 	defer q.wg.Done()
 
-	for task := range q.tasks {
+	for {
 		select {
-		case <-q.ctx.Done():
+		case <-q.drain:
 			return
 		default:
 		}
 
-		q.processTask(task)
+		// Take the wake channel before claiming so an Enqueue in between
+		// is not missed
+		wake := q.wake.wait()
+		if q.paused.Load() {
+			select {
+			case <-q.drain:
+			case <-wake:
+			}
+			continue
+		}
+		task, err := q.claim(sc)
+		if err != nil {
+			logging.Error("worker %d: claim task: %v", id, err)
+		}
+		if task != nil {
+			q.publish(task)
+			q.processTask(task)
+			continue
+		}
+
+		timer := time.NewTimer(q.nextReady(sc))
+		select {
+		case <-q.drain:
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
 	}
 }
 
@@ -235,39 +510,72 @@ func (q *Queue) processTask(task *Task) {
 	q.mu.RUnlock()
 
 	if !ok {
-		q.failTask(task, fmt.Errorf("no handler for task type: %s", task.Type))
+		err := Permanent(fmt.Errorf("no handler for task type: %s", task.Type))
+		q.recordAttempt(task, err)
+		q.failTask(task, err)
 		return
 	}
 
-	// Update status to running
-	now := time.Now()
-	task.Status = StatusRunning
-	task.StartedAt = &now
-	q.updateTask(task)
-
-	// Execute with timeout, injecting task ID into context
-	ctx, cancel := context.WithTimeout(q.ctx, q.taskTimeout)
+	// Register the task's context, then make sure it was not cancelled
+	// between the claim and the registration
+	ctx, cancel := context.WithCancel(q.ctx)
 	defer cancel()
+	q.mu.Lock()
+	q.running[task.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, task.ID)
+		q.mu.Unlock()
+	}()
+	if !q.holdsLease(task) {
+		logging.Debug("task %s cancelled before it started", task.ID)
+		return
+	}
+
+	// Execute with timeout, injecting task ID and type into context
+	ctx, cancelTimeout := context.WithTimeout(ctx, q.timeout(task.Type))
+	defer cancelTimeout()
 	ctx = context.WithValue(ctx, taskIDKey, task.ID)
+	ctx = context.WithValue(ctx, taskTypeKey, task.Type)
+	if task.JobID != "" {
+		ctx = context.WithValue(ctx, jobIDKey, task.JobID)
+	}
+	ctx = context.WithValue(ctx, checkpointKey, &checkpointer{q: q, task: task})
+	ctx = context.WithValue(ctx, progressKey, &Reporter{q: q, task: task})
 
-	result, err := handler(ctx, task.Payload)
+	payload, err := q.input(task)
+	if err != nil {
+		q.recordAttempt(task, err)
+		q.failTask(task, err)
+		return
+	}
+
+	result, err := handler(ctx, payload)
 	finishedAt := time.Now()
 	task.FinishedAt = &finishedAt
 
+	if err != nil && q.ctx.Err() != nil {
+		// Shutting down: hand the task back untouched for the next start
+		q.release(task)
+		return
+	}
+	q.recordAttempt(task, err)
+
 	if err != nil {
-		if task.RetryCount < task.MaxRetries {
+		if task.RetryCount < task.MaxRetries && !IsPermanent(err) {
 			task.RetryCount++
+			delay := backoff(q.retryDelay, q.maxDelay, task.RetryCount, err)
+			next := time.Now().Add(delay)
 			task.Status = StatusPending
-			q.updateTask(task)
-
-			// Re-queue after delay
-			go func() {
-				time.Sleep(q.retryDelay)
-				select {
-				case q.tasks <- task:
-				case <-q.ctx.Done():
-				}
-			}()
+			task.Error = err.Error()
+			task.NextAttemptAt = &next
+			if !q.updateTask(task) {
+				logging.Debug("task %s cancelled while running", task.ID)
+				return
+			}
+
+			logging.Debug("task %s failed, retry %d/%d in %v: %v", task.ID, task.RetryCount, task.MaxRetries, delay, err)
 			return
 		}
 		q.failTask(task, err)
@@ -276,81 +584,331 @@ func (q *Queue) processTask(task *Task) {
 
 	task.Status = StatusCompleted
 	task.Result = result
-	q.updateTask(task)
+	task.Error = ""
+	if !q.updateTask(task) {
+		logging.Debug("task %s cancelled while running, discarding result", task.ID)
+		return
+	}
 	logging.Debug("task %s completed", task.ID)
 }
 
+// timeout returns how long a task of the given type may run
+func (q *Queue) timeout(taskType TaskType) time.Duration {
+	if tc := q.types[taskType]; tc.Timeout > 0 {
+		return tc.Timeout
+	}
+	return q.taskTimeout
+}
+
+// retries returns how many times a failed task of the given type is retried
+func (q *Queue) retries(taskType TaskType) int {
+	if tc := q.types[taskType]; tc.MaxRetries != nil {
+		return *tc.MaxRetries
+	}
+	return q.maxRetries
+}
+
+// leaseTime is how long a claim lasts: the longest timeout of any type, so
+// a lease never expires under a task that is still within its timeout
+func leaseTime(cfg Config) time.Duration {
+	longest := cfg.TaskTimeout
+	for _, tc := range cfg.Types {
+		if tc.Timeout > longest {
+			longest = tc.Timeout
+		}
+	}
+	return longest + leaseGrace
+}
+
+// holdsLease reports whether task is still running under this worker's lease
+func (q *Queue) holdsLease(task *Task) bool {
+	var n int
+	err := q.db.QueryRow(`
+		SELECT COUNT(*) FROM tasks WHERE id = ? AND status = 'running' AND lease_id = ?
+	`, task.ID, task.lease).Scan(&n)
+	return err == nil && n > 0
+}
+
+// release returns a claimed task to pending without counting an attempt
+func (q *Queue) release(task *Task) {
+	_, err := q.db.Exec(`
+		UPDATE tasks SET status = 'pending', lease_id = NULL, lease_until = NULL
+		WHERE id = ? AND status = 'running' AND lease_id = ?
+	`, task.ID, task.lease)
+	if err != nil {
+		logging.Error("failed to release task %s: %v", task.ID, err)
+		return
+	}
+	task.Status = StatusPending
+	q.publish(task)
+}
+
 func (q *Queue) failTask(task *Task, err error) {
 	task.Status = StatusFailed
 	task.Error = err.Error()
+	task.NextAttemptAt = nil
 	now := time.Now()
 	task.FinishedAt = &now
-	q.updateTask(task)
+	if !q.updateTask(task) {
+		logging.Debug("task %s cancelled while running", task.ID)
+		return
+	}
 	logging.Error("task %s failed: %v", task.ID, err)
+	q.failDependents(task.ID, StatusFailed, fmt.Sprintf("dependency %s (%s) failed: %v", task.ID, task.Type, err))
 }
 
-func (q *Queue) updateTask(task *Task) {
-	_, err := q.db.Exec(`
+// updateTask saves the outcome of a claimed task and releases its lease,
+// publishing the change. It reports whether the task was still held: a
+// cancelled task or one whose lease was taken over is never overwritten.
+func (q *Queue) updateTask(task *Task) bool {
+	var readyAt *int64
+	if task.NextAttemptAt != nil {
+		ms := task.NextAttemptAt.UnixMilli()
+		readyAt = &ms
+	}
+	res, err := q.db.Exec(`
 		UPDATE tasks SET
 			status = ?,
 			result = ?,
 			error = ?,
 			started_at = ?,
 			finished_at = ?,
-			retry_count = ?
-		WHERE id = ?
-	`, task.Status, task.Result, task.Error, task.StartedAt, task.FinishedAt, task.RetryCount, task.ID)
+			retry_count = ?,
+			next_attempt_at = ?,
+			ready_at = COALESCE(?, ready_at),
+			lease_id = NULL,
+			lease_until = NULL
+		WHERE id = ? AND status = 'running' AND lease_id = ?
+	`, task.Status, task.Result, task.Error, task.StartedAt, task.FinishedAt, task.RetryCount, task.NextAttemptAt, readyAt, task.ID, task.lease)
 	if err != nil {
 		logging.Error("failed to update task %s: %v", task.ID, err)
+		return true
 	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return false
+	}
+	q.publish(task)
+	if task.Status == StatusCompleted {
+		// Dependents of this task may now be runnable
+		q.wake.broadcast()
+	}
+	return true
+}
+
+// EnqueueOptions are the optional settings for EnqueueWith
+type EnqueueOptions struct {
+	Priority int
+	// DedupeKey coalesces tasks of the same type: while one with this key
+	// is pending or running, or completed within the queue's dedupe window,
+	// enqueueing another returns it instead. A pending task takes on the
+	// newer payload and the higher priority.
+	DedupeKey string
+	// DependsOn holds IDs of tasks that must complete first. Their results
+	// are merged into this task's payload when it runs.
+	DependsOn []string
+	// JobID groups related tasks
+	JobID string
+	// RejectIfPaused fails with ErrQueuePaused instead of enqueueing while
+	// the queue is paused, for callers that would otherwise wait on a task
+	// that cannot run
+	RejectIfPaused bool
 }
 
 // Enqueue adds a new task to the queue
 func (q *Queue) Enqueue(taskType TaskType, payload json.RawMessage, priority int) (*Task, error) {
-	id := generateID()
+	return q.EnqueueWith(taskType, payload, EnqueueOptions{Priority: priority})
+}
+
+// EnqueueWith adds a new task to the queue, or merges it into an existing
+// one with the same dedupe key. The task is stored before any worker sees
+// it, so it is never lost; with MaxPending set, new work is refused instead
+// of dropped.
+func (q *Queue) EnqueueWith(taskType TaskType, payload json.RawMessage, opts EnqueueOptions) (*Task, error) {
+	if opts.RejectIfPaused {
+		unlock, err := q.holdUnpaused()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if opts.DedupeKey != "" {
+		existing, err := q.mergeDuplicate(tx, taskType, payload, opts)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if err := tx.Commit(); err != nil {
+				return nil, fmt.Errorf("commit: %w", err)
+			}
+			return existing, nil
+		}
+	}
+
+	if err := q.checkCapacity(tx); err != nil {
+		return nil, err
+	}
+	task, err := q.insert(tx, taskType, payload, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	q.publish(task)
+	q.wake.broadcast()
+
+	logging.Debug("task %s enqueued: %s", task.ID, task.Type)
+	return task, nil
+}
+
+// holdUnpaused fails with ErrQueuePaused if the queue is paused, and
+// otherwise keeps Pause from taking effect until unlock is called, so the
+// caller's enqueue lands before any pause
+func (q *Queue) holdUnpaused() (unlock func(), err error) {
+	q.pauseMu.RLock()
+	if q.paused.Load() {
+		q.pauseMu.RUnlock()
+		return nil, ErrQueuePaused
+	}
+	return q.pauseMu.RUnlock, nil
+}
+
+// mergeDuplicate folds a new task into a live or recent one with the same
+// dedupe key, returning it, or returns nil if there is none
+func (q *Queue) mergeDuplicate(tx *sql.Tx, taskType TaskType, payload json.RawMessage, opts EnqueueOptions) (*Task, error) {
+	existing, err := q.findDuplicate(tx, taskType, opts.DedupeKey)
+	if err != nil {
+		return nil, fmt.Errorf("find duplicate: %w", err)
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	if existing.Status == StatusPending {
+		if opts.Priority > existing.Priority {
+			existing.Priority = opts.Priority
+		}
+		if payload != nil {
+			existing.Payload = payload
+		}
+		_, err := tx.Exec(`UPDATE tasks SET payload = ?, priority = ? WHERE id = ?`, existing.Payload, existing.Priority, existing.ID)
+		if err != nil {
+			return nil, fmt.Errorf("merge task: %w", err)
+		}
+	}
+	logging.Debug("task %s: %s %q merged into %s task", existing.ID, taskType, opts.DedupeKey, existing.Status)
+	return existing, nil
+}
+
+// checkCapacity enforces MaxPending
+func (q *Queue) checkCapacity(tx *sql.Tx) error {
+	if q.maxPending <= 0 {
+		return nil
+	}
+	var pending int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status = 'pending'`).Scan(&pending); err != nil {
+		return fmt.Errorf("count pending tasks: %w", err)
+	}
+	if pending >= q.maxPending {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// insert stores a new pending task. Dependencies must exist and must not
+// have failed already.
+func (q *Queue) insert(tx *sql.Tx, taskType TaskType, payload json.RawMessage, opts EnqueueOptions) (*Task, error) {
+	for _, dep := range opts.DependsOn {
+		var status TaskStatus
+		err := tx.QueryRow(`SELECT status FROM tasks WHERE id = ?`, dep).Scan(&status)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("dependency %s not found", dep)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("check dependency %s: %w", dep, err)
+		}
+		if status == StatusFailed || status == StatusCancelled {
+			return nil, fmt.Errorf("dependency %s is %s", dep, status)
+		}
+	}
+
 	task := &Task{
-		ID:         id,
+		ID:         generateID(),
 		Type:       taskType,
-		Priority:   priority,
+		Priority:   opts.Priority,
 		Payload:    payload,
 		Status:     StatusPending,
-		MaxRetries: q.maxRetries,
+		MaxRetries: q.retries(taskType),
 		CreatedAt:  time.Now(),
+		DedupeKey:  opts.DedupeKey,
+		JobID:      opts.JobID,
+		DependsOn:  opts.DependsOn,
 	}
 
-	_, err := q.db.Exec(`
-		INSERT INTO tasks (id, type, priority, payload, status, max_retries, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, task.ID, task.Type, task.Priority, task.Payload, task.Status, task.MaxRetries, task.CreatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("insert task: %w", err)
+	var dependsOn sql.NullString
+	if len(task.DependsOn) > 0 {
+		raw, _ := json.Marshal(task.DependsOn)
+		dependsOn = sql.NullString{String: string(raw), Valid: true}
 	}
 
-	select {
-	case q.tasks <- task:
-	default:
-		return nil, fmt.Errorf("task queue full")
+	_, err := tx.Exec(`
+		INSERT INTO tasks (id, type, priority, payload, status, max_retries, created_at, ready_at, dedupe_key, job_id, depends_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, task.ID, task.Type, task.Priority, task.Payload, task.Status, task.MaxRetries, task.CreatedAt, task.CreatedAt.UnixMilli(),
+		nullString(task.DedupeKey), nullString(task.JobID), dependsOn)
+	if err != nil {
+		return nil, fmt.Errorf("insert task: %w", err)
 	}
-
-	logging.Debug("task %s enqueued: %s", task.ID, task.Type)
 	return task, nil
 }
 
-// GetTask retrieves a task by ID
-func (q *Queue) GetTask(id string) (*Task, error) {
-	var task Task
-	var payload, result, errStr sql.NullString
-	var startedAt, finishedAt sql.NullTime
-	err := q.db.QueryRow(`
-		SELECT id, type, priority, payload, status, result, error, created_at, started_at, finished_at, retry_count, max_retries
-		FROM tasks WHERE id = ?
-	`, id).Scan(&task.ID, &task.Type, &task.Priority, &payload, &task.Status, &result, &errStr, &task.CreatedAt, &startedAt, &finishedAt, &task.RetryCount, &task.MaxRetries)
+// findDuplicate returns the live or recently completed task of taskType
+// with the given dedupe key, if any
+func (q *Queue) findDuplicate(tx *sql.Tx, taskType TaskType, key string) (*Task, error) {
+	task, err := scanTask(tx.QueryRow(`
+		SELECT `+taskColumns+` FROM tasks
+		WHERE type = ? AND dedupe_key = ? AND status IN ('pending', 'running', 'completed')
+		ORDER BY CASE status WHEN 'completed' THEN 1 ELSE 0 END, created_at DESC
+		LIMIT 1
+	`, taskType, key))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	if task.Status == StatusCompleted {
+		if q.dedupe <= 0 || task.FinishedAt == nil || time.Since(*task.FinishedAt) > q.dedupe {
+			return nil, nil
+		}
+	}
+	return task, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// taskColumns lists the columns read by scanTask, in order
+const taskColumns = `id, type, priority, payload, status, result, error, created_at, started_at, finished_at, retry_count, max_retries, next_attempt_at, dedupe_key, job_id, depends_on, checkpoint, progress`
+
+// scanTask reads a row selected with taskColumns
+func scanTask(row interface{ Scan(...any) error }) (*Task, error) {
+	var task Task
+	var payload, result, errStr, dedupeKey, jobID, dependsOn, checkpoint, progress sql.NullString
+	var startedAt, finishedAt, nextAttempt sql.NullTime
+	err := row.Scan(&task.ID, &task.Type, &task.Priority, &payload, &task.Status, &result, &errStr, &task.CreatedAt, &startedAt, &finishedAt, &task.RetryCount, &task.MaxRetries, &nextAttempt, &dedupeKey, &jobID, &dependsOn, &checkpoint, &progress)
+	if err != nil {
+		return nil, err
+	}
 	if payload.Valid {
 		task.Payload = json.RawMessage(payload.String)
 	}
@@ -366,9 +924,35 @@ func (q *Queue) GetTask(id string) (*Task, error) {
 	if finishedAt.Valid {
 		task.FinishedAt = &finishedAt.Time
 	}
+	if nextAttempt.Valid {
+		task.NextAttemptAt = &nextAttempt.Time
+	}
+	task.DedupeKey = dedupeKey.String
+	task.JobID = jobID.String
+	if dependsOn.Valid {
+		json.Unmarshal([]byte(dependsOn.String), &task.DependsOn)
+	}
+	if checkpoint.Valid {
+		task.Checkpoint = json.RawMessage(checkpoint.String)
+	}
+	if progress.Valid {
+		json.Unmarshal([]byte(progress.String), &task.Progress)
+	}
 	return &task, nil
 }
 
+// GetTask retrieves a task by ID
+func (q *Queue) GetTask(id string) (*Task, error) {
+	task, err := scanTask(q.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
 // ListTasks returns recent tasks
 func (q *Queue) ListTasks(limit int) ([]*Task, error) {
 	if limit == 0 {
@@ -376,7 +960,7 @@ func (q *Queue) ListTasks(limit int) ([]*Task, error) {
 	}
 
 	rows, err := q.db.Query(`
-		SELECT id, type, priority, payload, status, result, error, created_at, started_at, finished_at, retry_count, max_retries
+		SELECT `+taskColumns+`
 		FROM tasks
 		ORDER BY created_at DESC
 		LIMIT ?
@@ -388,68 +972,67 @@ func (q *Queue) ListTasks(limit int) ([]*Task, error) {
 
 	var tasks []*Task
 	for rows.Next() {
-		var task Task
-		var payload, result, errStr sql.NullString
-		var startedAt, finishedAt sql.NullTime
-		if err := rows.Scan(&task.ID, &task.Type, &task.Priority, &payload, &task.Status, &result, &errStr, &task.CreatedAt, &startedAt, &finishedAt, &task.RetryCount, &task.MaxRetries); err != nil {
+		task, err := scanTask(rows)
+		if err != nil {
 			continue
 		}
-		if payload.Valid {
-			task.Payload = json.RawMessage(payload.String)
-		}
-		if result.Valid {
-			task.Result = json.RawMessage(result.String)
-		}
-		if errStr.Valid {
-			task.Error = errStr.String
-		}
-		if startedAt.Valid {
-			task.StartedAt = &startedAt.Time
-		}
-		if finishedAt.Valid {
-			task.FinishedAt = &finishedAt.Time
-		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 	return tasks, nil
 }
 
 // EnqueueAndWait adds a task and blocks until it completes or the context is cancelled.
+// It fails with ErrQueuePaused without enqueueing anything if the queue is
+// paused.
 func (q *Queue) EnqueueAndWait(ctx context.Context, taskType TaskType, payload json.RawMessage, priority int) (*Task, error) {
-	t, err := q.Enqueue(taskType, payload, priority)
+	t, err := q.EnqueueWith(taskType, payload, EnqueueOptions{Priority: priority, RejectIfPaused: true})
 	if err != nil {
 		return nil, err
 	}
+	return q.Wait(ctx, t.ID)
+}
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+// Wait blocks until task id finishes or ctx is done. A task that did not
+// complete is returned along with an error.
+func (q *Queue) Wait(ctx context.Context, id string) (*Task, error) {
+	done, stop := q.events.wait(id)
+	defer stop()
 
-	for {
+	// The task may have finished before the waiter was registered
+	current, err := q.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, fmt.Errorf("task %s not found", id)
+	}
+	if !isFinal(current.Status) {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-ticker.C:
-			current, err := q.GetTask(t.ID)
-			if err != nil {
-				return nil, err
-			}
-			if current == nil {
-				return nil, fmt.Errorf("task %s not found", t.ID)
-			}
-			switch current.Status {
-			case StatusCompleted:
-				return current, nil
-			case StatusFailed:
-				return current, fmt.Errorf("task failed: %s", current.Error)
-			}
+		case <-done:
+		}
+		if current, err = q.GetTask(id); err != nil {
+			return nil, err
 		}
 	}
+
+	switch current.Status {
+	case StatusCompleted:
+		return current, nil
+	case StatusCancelled:
+		return current, ErrTaskCancelled
+	default:
+		return current, fmt.Errorf("task failed: %s", current.Error)
+	}
 }
 
-// CancelTask cancels a pending task.
+// CancelTask cancels a pending or running task and the tasks that depend on
+// it. A running handler has its context cancelled, aborting in-flight LLM
+// calls and waits.
 func (q *Queue) CancelTask(id string) error {
 	result, err := q.db.Exec(`
-		UPDATE tasks SET status = 'failed', error = 'cancelled by user', finished_at = ?
+		UPDATE tasks SET status = 'cancelled', finished_at = ?, next_attempt_at = NULL, lease_id = NULL, lease_until = NULL
 		WHERE id = ? AND status IN ('pending', 'running')
 	`, time.Now(), id)
 	if err != nil {
@@ -459,9 +1042,34 @@ func (q *Queue) CancelTask(id string) error {
 	if rows == 0 {
 		return fmt.Errorf("task %s not found or already completed", id)
 	}
+	if t, err := q.GetTask(id); err == nil && t != nil {
+		q.publish(t)
+		q.failDependents(id, StatusCancelled, fmt.Sprintf("dependency %s (%s) cancelled", id, t.Type))
+	}
+
+	q.mu.RLock()
+	cancel := q.running[id]
+	q.mu.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+	logging.Info("task %s cancelled", id)
 	return nil
 }
 
+var lastID atomic.Int64
+
+// generateID returns a time-based ID, bumped when the clock has not moved
+// since the last one so tasks created together stay unique
 func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	for {
+		last := lastID.Load()
+		id := time.Now().UnixNano()
+		if id <= last {
+			id = last + 1
+		}
+		if lastID.CompareAndSwap(last, id) {
+			return fmt.Sprintf("%d", id)
+		}
+	}
 }
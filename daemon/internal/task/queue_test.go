@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
@@ -125,8 +126,46 @@ func TestCancelTask(t *testing.T) {
 	}
 
 	fetched, _ := q.GetTask(task.ID)
-	if fetched.Status != StatusFailed {
-		t.Errorf("expected status %s, got %s", StatusFailed, fetched.Status)
+	if fetched.Status != StatusCancelled {
+		t.Errorf("expected status %s, got %s", StatusCancelled, fetched.Status)
+	}
+}
+
+func TestCancelRunningTask(t *testing.T) {
+	q := newTestQueue(t)
+
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	q.RegisterHandler(TaskGitCommit, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		close(started)
+		<-ctx.Done()
+		close(aborted)
+		return json.RawMessage(`{"late":true}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	task, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), 0)
+	<-started
+
+	if err := q.CancelTask(task.ID); err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+
+	// The handler's late result must not overwrite the cancellation
+	time.Sleep(50 * time.Millisecond)
+	fetched, _ := q.GetTask(task.ID)
+	if fetched.Status != StatusCancelled {
+		t.Errorf("expected status %s, got %s", StatusCancelled, fetched.Status)
+	}
+	if fetched.Result != nil {
+		t.Errorf("expected no result, got %s", fetched.Result)
 	}
 }
 
@@ -153,8 +192,10 @@ func TestTaskIDInContext(t *testing.T) {
 	q := newTestQueue(t)
 
 	var capturedID string
+	var capturedType TaskType
 	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
 		capturedID = TaskIDFromContext(ctx)
+		capturedType = TaskTypeFromContext(ctx)
 		return json.RawMessage(`{"ok":true}`), nil
 	})
 
@@ -177,6 +218,9 @@ func TestTaskIDInContext(t *testing.T) {
 	if capturedID != result.ID {
 		t.Errorf("context task ID %q != result task ID %q", capturedID, result.ID)
 	}
+	if capturedType != TaskClipboardSummarize {
+		t.Errorf("expected task type in context, got %q", capturedType)
+	}
 }
 
 func TestTaskIDFromContextEmpty(t *testing.T) {
@@ -208,3 +252,287 @@ func TestEnqueueAndWait(t *testing.T) {
 		t.Errorf("expected completed, got %s", result.Status)
 	}
 }
+
+type retryLaterError struct{ after time.Duration }
+
+func (e retryLaterError) Error() string             { return "rate limited" }
+func (e retryLaterError) RetryDelay() time.Duration { return e.after }
+
+func TestRetryHonorsRetryDelay(t *testing.T) {
+	q := newTestQueue(t)
+
+	var attempts []time.Time
+	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return nil, fmt.Errorf("llm completion: %w", retryLaterError{after: 200 * time.Millisecond})
+		}
+		return json.RawMessage(`{}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := q.EnqueueAndWait(ctx, TaskClipboardSummarize, json.RawMessage(`{}`), 0)
+	if err != nil {
+		t.Fatalf("EnqueueAndWait: %v", err)
+	}
+	if result.Status != StatusCompleted || len(attempts) != 2 {
+		t.Fatalf("expected completion on second attempt, got %s after %d", result.Status, len(attempts))
+	}
+	if gap := attempts[1].Sub(attempts[0]); gap < 200*time.Millisecond {
+		t.Errorf("expected retry after at least 200ms, got %v", gap)
+	}
+}
+
+func TestPermanentErrorSkipsRetries(t *testing.T) {
+	q := newTestQueue(t)
+
+	attempts := 0
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		attempts++
+		return nil, fmt.Errorf("stat file: %w", Permanent(fmt.Errorf("no such file")))
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := q.EnqueueAndWait(ctx, TaskFileClassify, json.RawMessage(`{}`), 0)
+	if err == nil {
+		t.Fatal("expected task to fail")
+	}
+	if result.Status != StatusFailed || result.RetryCount != 0 {
+		t.Errorf("expected failure without retries, got %s after %d retries", result.Status, result.RetryCount)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetrySetsNextAttemptAt(t *testing.T) {
+	q, err := NewQueue(Config{
+		DBPath:     filepath.Join(t.TempDir(), "test.db"),
+		MaxWorkers: 1,
+		RetryDelay: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+
+	ran := make(chan struct{}, 1)
+	q.RegisterHandler(TaskGitCommit, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		ran <- struct{}{}
+		return nil, fmt.Errorf("connection refused")
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	before := time.Now()
+	task, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), 0)
+	<-ran
+
+	var fetched *Task
+	for i := 0; i < 50; i++ {
+		fetched, _ = q.GetTask(task.ID)
+		if fetched.NextAttemptAt != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fetched.Status != StatusPending || fetched.NextAttemptAt == nil {
+		t.Fatalf("expected pending retry with next_attempt_at, got %s %v", fetched.Status, fetched.NextAttemptAt)
+	}
+	if wait := fetched.NextAttemptAt.Sub(before); wait < 30*time.Minute || wait > time.Hour+time.Minute {
+		t.Errorf("expected next attempt in 30-60m, got %v", wait)
+	}
+	if fetched.Error != "connection refused" {
+		t.Errorf("expected last error recorded, got %q", fetched.Error)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second, 20: time.Second} {
+		for i := 0; i < 20; i++ {
+			got := backoff(base, max, attempt, fmt.Errorf("boom"))
+			if got < want/2 || got > want {
+				t.Fatalf("attempt %d: expected delay in [%v, %v], got %v", attempt, want/2, want, got)
+			}
+		}
+	}
+
+	if got := backoff(base, max, 1, retryLaterError{after: 3 * time.Second}); got != 3*time.Second {
+		t.Errorf("expected Retry-After to win, got %v", got)
+	}
+}
+
+func TestSubscribeReceivesEvents(t *testing.T) {
+	q := newTestQueue(t)
+	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+
+	events, unsubscribe := q.Subscribe(16)
+	defer unsubscribe()
+
+	q.Start()
+	defer q.Stop()
+
+	task, _ := q.Enqueue(TaskClipboardSummarize, json.RawMessage(`{}`), 0)
+
+	var statuses []TaskStatus
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.TaskID != task.ID {
+				continue
+			}
+			statuses = append(statuses, ev.Status)
+			if !ev.Done() {
+				continue
+			}
+		case <-timeout:
+			t.Fatalf("timed out, got %v", statuses)
+		}
+		break
+	}
+
+	want := []TaskStatus{StatusPending, StatusRunning, StatusCompleted}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, statuses)
+	}
+}
+
+func TestEnqueueAndWaitReturnsPromptly(t *testing.T) {
+	q := newTestQueue(t)
+	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := q.EnqueueAndWait(ctx, TaskClipboardSummarize, json.RawMessage(`{}`), 0); err != nil {
+		t.Fatalf("EnqueueAndWait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("expected completion without polling delay, took %v", elapsed)
+	}
+}
+
+func TestEnqueueAndWaitCancelled(t *testing.T) {
+	q := newTestQueue(t)
+	started := make(chan string, 1)
+	q.RegisterHandler(TaskGitCommit, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		started <- TaskIDFromContext(ctx)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	q.Start()
+	defer q.Stop()
+
+	go func() {
+		q.CancelTask(<-started)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.EnqueueAndWait(ctx, TaskGitCommit, json.RawMessage(`{}`), 0)
+	if err != ErrTaskCancelled {
+		t.Fatalf("expected ErrTaskCancelled, got %v", err)
+	}
+	if result.Status != StatusCancelled {
+		t.Errorf("expected cancelled, got %s", result.Status)
+	}
+}
+
+func TestDedupeMergesPendingTask(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	first, _ := q.EnqueueWith(TaskPipelineAutoFile, json.RawMessage(`{"n":1}`), EnqueueOptions{DedupeKey: "/tmp/a.zip"})
+	second, err := q.EnqueueWith(TaskPipelineAutoFile, json.RawMessage(`{"n":2}`), EnqueueOptions{Priority: 1, DedupeKey: "/tmp/a.zip"})
+	if err != nil {
+		t.Fatalf("EnqueueWith: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Fatalf("expected merge into %s, got new task %s", first.ID, second.ID)
+	}
+
+	fetched, _ := q.GetTask(first.ID)
+	if string(fetched.Payload) != `{"n":2}` || fetched.Priority != 1 {
+		t.Errorf("expected newer payload and higher priority, got %s priority %d", fetched.Payload, fetched.Priority)
+	}
+
+	other, _ := q.EnqueueWith(TaskPipelineAutoFile, json.RawMessage(`{}`), EnqueueOptions{DedupeKey: "/tmp/b.zip"})
+	classify, _ := q.EnqueueWith(TaskFileClassify, json.RawMessage(`{}`), EnqueueOptions{DedupeKey: "/tmp/a.zip"})
+	if other.ID == first.ID || classify.ID == first.ID {
+		t.Error("different keys or task types must not merge")
+	}
+
+	tasks, _ := q.ListTasks(10)
+	if len(tasks) != 3 {
+		t.Errorf("expected 3 tasks, got %d", len(tasks))
+	}
+}
+
+func TestDedupeWindowAfterCompletion(t *testing.T) {
+	q, err := NewQueue(Config{
+		DBPath:       filepath.Join(t.TempDir(), "test.db"),
+		MaxWorkers:   1,
+		DedupeWindow: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	runs := 0
+	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		runs++
+		return json.RawMessage(`{"summary":"s"}`), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := EnqueueOptions{DedupeKey: "hash"}
+	first, _ := q.EnqueueWith(TaskClipboardSummarize, json.RawMessage(`{}`), opts)
+	for {
+		if fetched, _ := q.GetTask(first.ID); fetched.Status == StatusCompleted {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("task did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	repeat, _ := q.EnqueueWith(TaskClipboardSummarize, json.RawMessage(`{}`), opts)
+	if repeat.ID != first.ID || repeat.Status != StatusCompleted {
+		t.Errorf("expected completed task %s to absorb the repeat, got %s (%s)", first.ID, repeat.ID, repeat.Status)
+	}
+	if runs != 1 {
+		t.Errorf("expected 1 run, got %d", runs)
+	}
+
+	// Outside the window the task runs again
+	q.db.Exec(`UPDATE tasks SET finished_at = ? WHERE id = ?`, time.Now().Add(-2*time.Hour), first.ID)
+	fresh, _ := q.EnqueueWith(TaskClipboardSummarize, json.RawMessage(`{}`), opts)
+	if fresh.ID == first.ID {
+		t.Error("expected a new task once the dedupe window passed")
+	}
+}
@@ -0,0 +1,253 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/bender/internal/logging"
+)
+
+// Retention bounds the task history. Only finished tasks are pruned, and
+// never one whose result a waiting dependent still needs.
+type Retention struct {
+	// MaxAge deletes finished tasks older than this. Zero keeps them.
+	MaxAge time.Duration
+	// StatusMaxAge overrides MaxAge for particular final statuses
+	StatusMaxAge map[TaskStatus]time.Duration
+	// MaxRows keeps at most this many finished tasks, newest first. Zero
+	// means unlimited.
+	MaxRows int
+	// ScrubAfter clears the payload, result and checkpoint of completed and
+	// cancelled tasks older than this, keeping the rest of the row. Zero
+	// never scrubs.
+	ScrubAfter time.Duration
+	// ArchivePath, if set, is a JSON lines file deleted tasks are appended
+	// to. Tasks that cannot be archived are not deleted.
+	ArchivePath string
+}
+
+// PruneResult reports what a prune removed, or would remove on a dry run
+type PruneResult struct {
+	Deleted  int  `json:"deleted"`
+	Scrubbed int  `json:"scrubbed"`
+	Archived int  `json:"archived"`
+	DryRun   bool `json:"dry_run"`
+}
+
+// Retention returns the queue's configured retention policy
+func (q *Queue) Retention() Retention {
+	return q.retention
+}
+
+// OnPrune registers a function called after each pass of the janitor
+func (q *Queue) OnPrune(fn func(PruneResult)) {
+	q.mu.Lock()
+	q.pruneHooks = append(q.pruneHooks, fn)
+	q.mu.Unlock()
+}
+
+// janitor enforces the retention policy every interval until the queue
+// stops
+func (q *Queue) janitor(interval time.Duration) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		res, err := q.Prune(q.retention, false)
+		if err != nil {
+			logging.Error("task janitor: %v", err)
+		} else {
+			if res.Deleted > 0 || res.Scrubbed > 0 {
+				logging.Info("task janitor: deleted %d tasks, scrubbed %d", res.Deleted, res.Scrubbed)
+			}
+			q.mu.RLock()
+			hooks := q.pruneHooks
+			q.mu.RUnlock()
+			for _, fn := range hooks {
+				fn(*res)
+			}
+		}
+
+		select {
+		case <-q.drain:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finalNotNeeded matches finished tasks that no unfinished task depends on
+const finalNotNeeded = `status IN ('completed', 'failed', 'cancelled') AND id NOT IN (
+	SELECT d.value FROM tasks t, json_each(t.depends_on) d
+	WHERE t.depends_on IS NOT NULL AND t.status IN ('pending', 'running')
+)`
+
+// Prune applies a retention policy to the task history. With dryRun it only
+// counts what would change.
+func (q *Queue) Prune(r Retention, dryRun bool) (*PruneResult, error) {
+	res := &PruneResult{DryRun: dryRun}
+	now := time.Now()
+	var archived []byte
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := expiredClause(r, now)
+	if where != "" {
+		if dryRun {
+			err = tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+where, args...).Scan(&res.Deleted)
+			if err != nil {
+				return nil, fmt.Errorf("count expired tasks: %w", err)
+			}
+		} else {
+			if r.ArchivePath != "" {
+				if archived, res.Archived, err = archiveLines(tx, where, args); err != nil {
+					return nil, err
+				}
+			}
+			result, err := tx.Exec(`DELETE FROM tasks WHERE `+where, args...)
+			if err != nil {
+				return nil, fmt.Errorf("delete expired tasks: %w", err)
+			}
+			n, _ := result.RowsAffected()
+			res.Deleted = int(n)
+			if _, err := tx.Exec(`DELETE FROM task_attempts WHERE task_id NOT IN (SELECT id FROM tasks)`); err != nil {
+				return nil, fmt.Errorf("delete attempts of expired tasks: %w", err)
+			}
+		}
+	}
+
+	if r.ScrubAfter > 0 {
+		// Failed tasks keep their payload so they can be retried
+		scrub := finalNotNeeded + ` AND status != 'failed' AND COALESCE(finished_at, created_at) < ? AND (payload IS NOT NULL OR result IS NOT NULL OR checkpoint IS NOT NULL)`
+		cutoff := now.Add(-r.ScrubAfter)
+		if dryRun {
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+scrub, cutoff).Scan(&res.Scrubbed); err != nil {
+				return nil, fmt.Errorf("count tasks to scrub: %w", err)
+			}
+		} else {
+			result, err := tx.Exec(`UPDATE tasks SET payload = NULL, result = NULL, checkpoint = NULL WHERE `+scrub, cutoff)
+			if err != nil {
+				return nil, fmt.Errorf("scrub tasks: %w", err)
+			}
+			n, _ := result.RowsAffected()
+			res.Scrubbed = int(n)
+		}
+	}
+
+	// The archive is written and synced before the deletion commits, so a
+	// failed write keeps the tasks. If the commit fails instead, the lines
+	// are cut off again so a later prune does not archive them twice.
+	offset := int64(-1)
+	if len(archived) > 0 {
+		if offset, err = appendArchive(r.ArchivePath, archived); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		if offset >= 0 {
+			if err := os.Truncate(r.ArchivePath, offset); err != nil {
+				logging.Warn("failed to undo archive of unpruned tasks: %v", err)
+			}
+		}
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
+
+// expiredClause builds the condition matching tasks the policy deletes, or
+// "" if it deletes nothing
+func expiredClause(r Retention, now time.Time) (string, []any) {
+	var conds []string
+	var args []any
+	for _, status := range []TaskStatus{StatusCompleted, StatusFailed, StatusCancelled} {
+		age, ok := r.StatusMaxAge[status]
+		if !ok {
+			age = r.MaxAge
+		}
+		if age > 0 {
+			conds = append(conds, `(status = ? AND COALESCE(finished_at, created_at) < ?)`)
+			args = append(args, status, now.Add(-age))
+		}
+	}
+	if r.MaxRows > 0 {
+		conds = append(conds, `id IN (
+			SELECT id FROM tasks WHERE status IN ('completed', 'failed', 'cancelled')
+			ORDER BY created_at DESC LIMIT -1 OFFSET ?
+		)`)
+		args = append(args, r.MaxRows)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return finalNotNeeded + ` AND (` + strings.Join(conds, " OR ") + `)`, args
+}
+
+// archiveLines encodes the tasks matching where as JSON lines
+func archiveLines(tx *sql.Tx, where string, args []any) ([]byte, int, error) {
+	rows, err := tx.Query(`SELECT `+taskColumns+` FROM tasks WHERE `+where+` ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("select tasks to archive: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []byte
+	n := 0
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan task to archive: %w", err)
+		}
+		line, err := json.Marshal(t)
+		if err != nil {
+			return nil, 0, fmt.Errorf("encode task %s: %w", t.ID, err)
+		}
+		lines = append(append(lines, line...), '\n')
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return lines, n, nil
+}
+
+// appendArchive appends lines to the archive, creating it if needed, and
+// syncs it to disk. It returns the size the archive had before.
+func appendArchive(path string, lines []byte) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("create archive directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("open archive: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("stat archive: %w", err)
+	}
+	offset := info.Size()
+
+	_, err = f.Write(lines)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a partial line behind
+		os.Truncate(path, offset)
+		return 0, fmt.Errorf("write archive: %w", err)
+	}
+	return offset, nil
+}
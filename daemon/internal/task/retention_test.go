@@ -0,0 +1,244 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// finishedTask adds a task that finished with status age ago
+func finishedTask(t *testing.T, q *Queue, status TaskStatus, age time.Duration) *Task {
+	t.Helper()
+	task, err := q.Enqueue(TaskClipboardSummarize, json.RawMessage(`{"content":"secret"}`), 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	at := time.Now().Add(-age)
+	_, err = q.db.Exec(`UPDATE tasks SET status = ?, result = '{"summary":"s"}', created_at = ?, finished_at = ? WHERE id = ?`, status, at, at, task.ID)
+	if err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	return task
+}
+
+func TestPruneMaxAge(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	old := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	oldFailed := finishedTask(t, q, StatusFailed, 48*time.Hour)
+	recent := finishedTask(t, q, StatusCompleted, time.Hour)
+	pending, _ := q.Enqueue(TaskClipboardSummarize, nil, 0)
+	q.db.Exec(`UPDATE tasks SET created_at = ? WHERE id = ?`, time.Now().Add(-72*time.Hour), pending.ID)
+
+	policy := Retention{
+		MaxAge:       24 * time.Hour,
+		StatusMaxAge: map[TaskStatus]time.Duration{StatusFailed: 7 * 24 * time.Hour},
+	}
+
+	dry, err := q.Prune(policy, true)
+	if err != nil {
+		t.Fatalf("Prune dry run: %v", err)
+	}
+	if dry.Deleted != 1 || !dry.DryRun {
+		t.Errorf("expected dry run to report 1 deletion, got %+v", dry)
+	}
+	if got, _ := q.GetTask(old.ID); got == nil {
+		t.Fatal("dry run should not delete")
+	}
+
+	res, err := q.Prune(policy, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Deleted != 1 {
+		t.Errorf("expected 1 deletion, got %+v", res)
+	}
+	for _, tc := range []struct {
+		task *Task
+		kept bool
+	}{{old, false}, {oldFailed, true}, {recent, true}, {pending, true}} {
+		got, _ := q.GetTask(tc.task.ID)
+		if (got != nil) != tc.kept {
+			t.Errorf("task %s: expected kept=%v", tc.task.ID, tc.kept)
+		}
+	}
+}
+
+func TestPruneMaxRows(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	oldest := finishedTask(t, q, StatusCompleted, 3*time.Hour)
+	finishedTask(t, q, StatusCompleted, 2*time.Hour)
+	finishedTask(t, q, StatusCancelled, time.Hour)
+
+	res, err := q.Prune(Retention{MaxRows: 2}, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Deleted != 1 {
+		t.Errorf("expected 1 deletion, got %+v", res)
+	}
+	if got, _ := q.GetTask(oldest.ID); got != nil {
+		t.Error("expected the oldest task to be deleted")
+	}
+}
+
+func TestPruneScrubKeepsMetadata(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	old := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	recent := finishedTask(t, q, StatusCompleted, time.Hour)
+
+	res, err := q.Prune(Retention{ScrubAfter: 24 * time.Hour}, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Scrubbed != 1 || res.Deleted != 0 {
+		t.Errorf("expected 1 scrubbed, got %+v", res)
+	}
+
+	got, _ := q.GetTask(old.ID)
+	if got == nil || got.Payload != nil || got.Result != nil {
+		t.Fatalf("expected scrubbed task with metadata, got %+v", got)
+	}
+	if got.Type != TaskClipboardSummarize || got.Status != StatusCompleted {
+		t.Errorf("metadata lost: %+v", got)
+	}
+	if kept, _ := q.GetTask(recent.ID); kept.Payload == nil {
+		t.Error("recent task should keep its payload")
+	}
+
+	if again, _ := q.Prune(Retention{ScrubAfter: 24 * time.Hour}, false); again.Scrubbed != 0 {
+		t.Errorf("expected nothing left to scrub, got %+v", again)
+	}
+}
+
+func TestPruneKeepsNeededDependency(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	parent := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	if _, err := q.EnqueueWith(TaskFileRename, nil, EnqueueOptions{DependsOn: []string{parent.ID}}); err != nil {
+		t.Fatalf("EnqueueWith: %v", err)
+	}
+
+	res, err := q.Prune(Retention{MaxAge: time.Hour, ScrubAfter: time.Hour}, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Deleted != 0 || res.Scrubbed != 0 {
+		t.Errorf("expected the parent of a pending task to be kept, got %+v", res)
+	}
+}
+
+func TestPruneArchives(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	old := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	path := filepath.Join(t.TempDir(), "archive", "tasks.jsonl")
+
+	res, err := q.Prune(Retention{MaxAge: 24 * time.Hour, ArchivePath: path}, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if res.Archived != 1 || res.Deleted != 1 {
+		t.Errorf("expected 1 archived and deleted, got %+v", res)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatal("archive is empty")
+	}
+	var archived Task
+	if err := json.Unmarshal(scanner.Bytes(), &archived); err != nil {
+		t.Fatalf("decode archive: %v", err)
+	}
+	if archived.ID != old.ID || string(archived.Payload) != `{"content":"secret"}` {
+		t.Errorf("unexpected archived task: %+v", archived)
+	}
+}
+
+func TestJanitorRunsHooks(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(Config{
+		DBPath:        filepath.Join(dir, "test.db"),
+		MaxWorkers:    1,
+		Retention:     Retention{MaxAge: time.Hour},
+		PruneInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	finishedTask(t, q, StatusCompleted, 2*time.Hour)
+
+	done := make(chan PruneResult, 1)
+	q.OnPrune(func(res PruneResult) { done <- res })
+	q.Start()
+	defer q.Stop()
+
+	select {
+	case res := <-done:
+		if res.Deleted != 1 {
+			t.Errorf("expected janitor to delete 1 task, got %+v", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor did not run")
+	}
+}
+
+func TestPruneArchivesOnlyCommittedDeletes(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+	policy := Retention{MaxAge: 24 * time.Hour, ArchivePath: path}
+
+	q.db.Exec(`CREATE TRIGGER block_delete BEFORE DELETE ON tasks BEGIN SELECT RAISE(ABORT, 'blocked'); END`)
+	if _, err := q.Prune(policy, false); err == nil {
+		t.Fatal("expected the prune to fail")
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("failed prune should not archive, got %s", data)
+	}
+
+	q.db.Exec(`DROP TRIGGER block_delete`)
+	if _, err := q.Prune(policy, false); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if n := bytes.Count(data, []byte("\n")); n != 1 {
+		t.Errorf("expected the task archived once, got %d lines", n)
+	}
+}
+
+func TestPruneKeepsTasksWhenArchiveFails(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	old := finishedTask(t, q, StatusCompleted, 48*time.Hour)
+	// The archive's directory is a file, so it cannot be created
+	blocker := filepath.Join(t.TempDir(), "archive")
+	os.WriteFile(blocker, nil, 0644)
+
+	_, err := q.Prune(Retention{MaxAge: 24 * time.Hour, ArchivePath: filepath.Join(blocker, "tasks.jsonl")}, false)
+	if err == nil {
+		t.Fatal("expected the prune to fail")
+	}
+	if got, _ := q.GetTask(old.ID); got == nil {
+		t.Error("task should be kept when it cannot be archived")
+	}
+}
@@ -0,0 +1,59 @@
+package task
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// PermanentError marks a handler failure that a retry cannot fix, such as a
+// malformed payload or a missing file. The queue fails the task at once.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so the queue does not retry it. A nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, is permanent
+func IsPermanent(err error) bool {
+	var perm *PermanentError
+	return errors.As(err, &perm)
+}
+
+// retryDelayer is implemented by errors that know when a retry may succeed,
+// such as rate-limit responses carrying Retry-After
+type retryDelayer interface {
+	RetryDelay() time.Duration
+}
+
+// backoff returns the wait before retry number attempt (1-based): base
+// doubled per attempt and capped at max, with the upper half jittered so
+// tasks failing together do not retry in lockstep. A longer delay requested
+// by err wins.
+func backoff(base, max time.Duration, attempt int, err error) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if half := int64(d / 2); half > 0 {
+		d = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	var rd retryDelayer
+	if errors.As(err, &rd) && rd.RetryDelay() > d {
+		d = rd.RetryDelay()
+	}
+	return d
+}
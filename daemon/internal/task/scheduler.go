@@ -0,0 +1,169 @@
+package task
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// Priorities used by the daemon. Tasks at PriorityInteractive or above were
+// requested by a user over RPC and may run on reserved workers.
+const (
+	PriorityBackground  = 0
+	PriorityInteractive = 1
+)
+
+const (
+	// leaseGrace is how long past the task timeout a claimed task stays
+	// leased before another worker may take it over
+	leaseGrace = time.Minute
+	// idlePoll bounds how long an idle worker sleeps without a wake-up, so
+	// expired leases are noticed
+	idlePoll = 5 * time.Second
+)
+
+// scope limits which tasks a worker claims
+type scope struct {
+	interactiveOnly bool
+	// types restricts a dedicated pool's workers to its task type
+	types []TaskType
+	// exclude keeps shared workers off types that have their own pool
+	exclude []TaskType
+}
+
+// where returns the scope as a condition on the tasks table
+func (s scope) where() (string, []any) {
+	cond := `priority >= ?`
+	args := []any{minPriority(s.interactiveOnly)}
+	if len(s.types) > 0 {
+		cond += ` AND type IN (` + placeholders(len(s.types)) + `)`
+		for _, t := range s.types {
+			args = append(args, t)
+		}
+	}
+	if len(s.exclude) > 0 {
+		cond += ` AND type NOT IN (` + placeholders(len(s.exclude)) + `)`
+		for _, t := range s.exclude {
+			args = append(args, t)
+		}
+	}
+	return cond, args
+}
+
+// claim leases the next runnable task in scope in one atomic statement, or
+// returns nil if there is none. The tasks table is the queue: ordering is
+// strict by priority, except that a task gains one priority level for every
+// aging interval it has been ready, so background work cannot starve. With
+// aging disabled priority is strict. Tasks wait for their dependencies to
+// complete. A running task whose lease has expired is taken over.
+func (q *Queue) claim(sc scope) (*Task, error) {
+	now := time.Now()
+	task := &Task{
+		Status:    StatusRunning,
+		StartedAt: &now,
+		lease:     newLeaseID(),
+	}
+	cond, condArgs := sc.where()
+	args := []any{now, task.lease, now.Add(q.leaseTime).UnixMilli(), now.UnixMilli(), now.UnixMilli()}
+	args = append(args, condArgs...)
+	order := "priority DESC, ready_at ASC"
+	if q.aging > 0 {
+		order = "ready_at - priority * ? ASC"
+		args = append(args, q.aging.Milliseconds())
+	}
+
+	var payload []byte
+	var jobID, dependsOn, checkpoint sql.NullString
+	err := q.db.QueryRow(`
+		UPDATE tasks SET
+			status = 'running',
+			started_at = ?,
+			next_attempt_at = NULL,
+			progress = NULL,
+			lease_id = ?,
+			lease_until = ?
+		WHERE id = (
+			SELECT id FROM tasks
+			WHERE ((status = 'pending' AND ready_at <= ?) OR (status = 'running' AND lease_until < ?))
+				AND `+cond+` AND `+depsMet+`
+			ORDER BY `+order+`, created_at ASC
+			LIMIT 1
+		)
+		RETURNING id, type, priority, payload, created_at, retry_count, max_retries, job_id, depends_on, checkpoint
+	`, args...).Scan(&task.ID, &task.Type, &task.Priority, &payload, &task.CreatedAt, &task.RetryCount, &task.MaxRetries, &jobID, &dependsOn, &checkpoint)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	task.Payload = payload
+	task.JobID = jobID.String
+	if dependsOn.Valid {
+		json.Unmarshal([]byte(dependsOn.String), &task.DependsOn)
+	}
+	if checkpoint.Valid {
+		task.Checkpoint = json.RawMessage(checkpoint.String)
+	}
+	return task, nil
+}
+
+// nextReady returns how long an idle worker may sleep before a pending task
+// in its scope becomes runnable
+func (q *Queue) nextReady(sc scope) time.Duration {
+	wait := idlePoll
+	cond, args := sc.where()
+	var next sql.NullInt64
+	err := q.db.QueryRow(`
+		SELECT MIN(ready_at) FROM tasks WHERE status = 'pending' AND `+cond+` AND `+depsMet, args...).Scan(&next)
+	if err == nil && next.Valid {
+		if d := time.Until(time.UnixMilli(next.Int64)); d < wait {
+			wait = d
+		}
+	}
+	if wait < 10*time.Millisecond {
+		wait = 10 * time.Millisecond
+	}
+	return wait
+}
+
+func minPriority(interactiveOnly bool) int {
+	if interactiveOnly {
+		return PriorityInteractive
+	}
+	return math.MinInt32
+}
+
+func newLeaseID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signal wakes every idle worker at once
+type signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newSignal() *signal {
+	return &signal{ch: make(chan struct{})}
+}
+
+// wait returns a channel closed by the next broadcast
+func (s *signal) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ch
+}
+
+func (s *signal) broadcast() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+}
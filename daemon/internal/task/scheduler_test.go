@@ -0,0 +1,357 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClaimStrictPriority(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	bg1, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	bg2, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	ui, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+
+	var order []string
+	for i := 0; i < 3; i++ {
+		task, err := q.claim(scope{})
+		if err != nil || task == nil {
+			t.Fatalf("claim: %v %v", task, err)
+		}
+		order = append(order, task.ID)
+	}
+	if order[0] != ui.ID || order[1] != bg1.ID || order[2] != bg2.ID {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	if task, _ := q.claim(scope{}); task != nil {
+		t.Errorf("expected empty queue, claimed %s", task.ID)
+	}
+}
+
+func TestClaimAging(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	old, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+	q.db.Exec(`UPDATE tasks SET ready_at = ? WHERE id = ?`, time.Now().Add(-2*time.Minute).UnixMilli(), old.ID)
+
+	task, _ := q.claim(scope{})
+	if task == nil || task.ID != old.ID {
+		t.Errorf("expected aged background task first, got %v", task)
+	}
+}
+
+func TestClaimOrderSurvivesRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	q, _ := NewQueue(Config{DBPath: dbPath, MaxWorkers: 1})
+	bg, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	ui, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+	q.db.Close()
+
+	// The order lives in the tasks table, not in memory
+	q, _ = NewQueue(Config{DBPath: dbPath, MaxWorkers: 1})
+	defer q.Stop()
+	first, _ := q.claim(scope{})
+	second, _ := q.claim(scope{})
+	if first == nil || second == nil || first.ID != ui.ID || second.ID != bg.ID {
+		t.Errorf("expected %s then %s after restart, got %v then %v", ui.ID, bg.ID, first, second)
+	}
+}
+
+func TestClaimInteractiveOnly(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	if task, _ := q.claim(scope{interactiveOnly: true}); task != nil {
+		t.Fatalf("reserved worker claimed background task %s", task.ID)
+	}
+
+	ui, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+	if task, _ := q.claim(scope{interactiveOnly: true}); task == nil || task.ID != ui.ID {
+		t.Errorf("expected interactive task, got %v", task)
+	}
+}
+
+func TestClaimTakesOverExpiredLease(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	first, _ := q.claim(scope{})
+	if again, _ := q.claim(scope{}); again != nil {
+		t.Fatalf("leased task claimed twice")
+	}
+
+	q.db.Exec(`UPDATE tasks SET lease_until = ? WHERE id = ?`, time.Now().Add(-time.Second).UnixMilli(), first.ID)
+	second, _ := q.claim(scope{})
+	if second == nil || second.ID != first.ID {
+		t.Fatalf("expected expired lease to be taken over, got %v", second)
+	}
+
+	// The original holder can no longer record a result
+	first.Status = StatusCompleted
+	if q.updateTask(first) {
+		t.Error("stale lease holder overwrote the task")
+	}
+}
+
+func TestEnqueueNeverDrops(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	for i := 0; i < 250; i++ {
+		if _, err := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	var pending int
+	q.db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status = 'pending'`).Scan(&pending)
+	if pending != 250 {
+		t.Errorf("expected 250 pending tasks, got %d", pending)
+	}
+}
+
+func TestEnqueueMaxPending(t *testing.T) {
+	q, err := NewQueue(Config{DBPath: filepath.Join(t.TempDir(), "test.db"), MaxPending: 2})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Stop()
+
+	q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	if _, err := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	tasks, _ := q.ListTasks(10)
+	if len(tasks) != 2 {
+		t.Errorf("rejected task should not be stored, got %d tasks", len(tasks))
+	}
+}
+
+func TestStartRecoversInterruptedTasks(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	q, _ := NewQueue(Config{DBPath: dbPath, MaxWorkers: 1})
+	task, _ := q.Enqueue(TaskClipboardSummarize, json.RawMessage(`{}`), PriorityBackground)
+	q.claim(scope{}) // simulate a crash mid-task
+	q.db.Close()
+
+	q, _ = NewQueue(Config{DBPath: dbPath, MaxWorkers: 1})
+	q.RegisterHandler(TaskClipboardSummarize, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if fetched, _ := q.GetTask(task.ID); fetched.Status == StatusCompleted {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("interrupted task was not run after restart")
+}
+
+func TestReservedWorkerRunsInteractiveTask(t *testing.T) {
+	q, err := NewQueue(Config{
+		DBPath:          filepath.Join(t.TempDir(), "test.db"),
+		MaxWorkers:      2,
+		ReservedWorkers: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	q.RegisterHandler(TaskPipelineAutoFile, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		started <- struct{}{}
+		<-release
+		return json.RawMessage(`{}`), nil
+	})
+	q.RegisterHandler(TaskGitCommit, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+	defer close(release)
+
+	for i := 0; i < 3; i++ {
+		q.Enqueue(TaskPipelineAutoFile, json.RawMessage(`{}`), PriorityBackground)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.EnqueueAndWait(ctx, TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+	if err != nil {
+		t.Fatalf("interactive task blocked behind background work: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("expected completed, got %s", result.Status)
+	}
+
+	if n := len(started); n != 0 {
+		t.Errorf("expected only the general worker to run background work, got %d more running", n)
+	}
+}
+
+func TestClaimScopesByType(t *testing.T) {
+	q := newTestQueue(t)
+	defer q.Stop()
+
+	classify, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	shot, _ := q.Enqueue(TaskPipelineScreenshot, json.RawMessage(`{}`), PriorityInteractive)
+
+	shared := scope{exclude: []TaskType{TaskPipelineScreenshot}}
+	if task, _ := q.claim(shared); task == nil || task.ID != classify.ID {
+		t.Fatalf("expected shared worker to claim %s, got %+v", classify.ID, task)
+	}
+	if task, _ := q.claim(shared); task != nil {
+		t.Fatalf("shared worker claimed pooled task %s", task.ID)
+	}
+	if task, _ := q.claim(scope{types: []TaskType{TaskPipelineScreenshot}}); task == nil || task.ID != shot.ID {
+		t.Fatalf("expected pool worker to claim %s, got %+v", shot.ID, task)
+	}
+}
+
+func TestTypeTimeoutAndRetries(t *testing.T) {
+	one, zero := 1, 0
+	q, err := NewQueue(Config{
+		DBPath:      filepath.Join(t.TempDir(), "test.db"),
+		MaxWorkers:  1,
+		MaxRetries:  3,
+		RetryDelay:  10 * time.Millisecond,
+		TaskTimeout: time.Minute,
+		Types: map[TaskType]TypeConfig{
+			TaskFileClassify: {Timeout: 50 * time.Millisecond, MaxRetries: &one},
+			TaskGitCommit:    {MaxRetries: &zero},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	q.Start()
+	defer q.Stop()
+
+	if other, _ := q.Enqueue(TaskFileRename, nil, 0); other.MaxRetries != 3 {
+		t.Errorf("expected default max retries for other types, got %d", other.MaxRetries)
+	}
+	if never, _ := q.Enqueue(TaskGitCommit, nil, 0); never.MaxRetries != 0 {
+		t.Errorf("expected no retries for a type configured with 0, got %d", never.MaxRetries)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.EnqueueAndWait(ctx, TaskFileClassify, json.RawMessage(`{}`), PriorityInteractive)
+	if err == nil {
+		t.Fatal("expected the task to time out")
+	}
+	if result.Status != StatusFailed || result.MaxRetries != 1 || result.RetryCount != 1 {
+		t.Errorf("expected failure after 1 retry, got %s after %d/%d", result.Status, result.RetryCount, result.MaxRetries)
+	}
+}
+
+func TestTypePoolNotStarved(t *testing.T) {
+	q, err := NewQueue(Config{
+		DBPath:     filepath.Join(t.TempDir(), "test.db"),
+		MaxWorkers: 1,
+		Types: map[TaskType]TypeConfig{
+			TaskPipelineScreenshot: {Workers: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		started <- struct{}{}
+		<-release
+		return json.RawMessage(`{}`), nil
+	})
+	q.RegisterHandler(TaskPipelineScreenshot, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+
+	q.Start()
+	defer q.Stop()
+	defer close(release)
+
+	// Occupy the only shared worker
+	q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityInteractive)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := q.EnqueueAndWait(ctx, TaskPipelineScreenshot, json.RawMessage(`{}`), PriorityBackground)
+	if err != nil {
+		t.Fatalf("pooled task blocked behind shared work: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("expected completed, got %s", result.Status)
+	}
+}
+
+func TestPausedQueueDoesNotClaim(t *testing.T) {
+	q := newTestQueue(t)
+	q.RegisterHandler(TaskFileClassify, func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{}`), nil
+	})
+	q.Pause()
+	q.Start()
+	defer q.Stop()
+
+	task, err := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityInteractive)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := q.GetTask(task.ID); got.Status != StatusPending {
+		t.Fatalf("expected paused queue to leave the task pending, got %s", got.Status)
+	}
+
+	// Synchronous callers are told rather than left waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := q.EnqueueAndWait(ctx, TaskFileClassify, json.RawMessage(`{}`), PriorityInteractive); err != ErrQueuePaused {
+		t.Fatalf("expected ErrQueuePaused, got %v", err)
+	}
+
+	q.Resume()
+	if done, err := q.Wait(ctx, task.ID); err != nil || done.Status != StatusCompleted {
+		t.Fatalf("expected task to run after resume, got %v", err)
+	}
+}
+
+func TestClaimAgingDisabled(t *testing.T) {
+	q, err := NewQueue(Config{DBPath: filepath.Join(t.TempDir(), "test.db"), MaxWorkers: 1, Aging: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	old, _ := q.Enqueue(TaskFileClassify, json.RawMessage(`{}`), PriorityBackground)
+	ui, _ := q.Enqueue(TaskGitCommit, json.RawMessage(`{}`), PriorityInteractive)
+	q.db.Exec(`UPDATE tasks SET ready_at = ? WHERE id = ?`, time.Now().Add(-time.Hour).UnixMilli(), old.ID)
+
+	task, _ := q.claim(scope{})
+	if task == nil || task.ID != ui.ID {
+		t.Errorf("expected interactive task first with aging disabled, got %v", task)
+	}
+}
@@ -0,0 +1,258 @@
+package usage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dayFormat is the layout of the day column, in local time
+const dayFormat = "2006-01-02"
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+// Record is the token usage of a single LLM call
+type Record struct {
+	TaskID           string    `json:"task_id,omitempty"`
+	TaskType         string    `json:"task_type"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Query filters a usage report. Zero values match everything.
+type Query struct {
+	Since    time.Time
+	Until    time.Time
+	Provider string
+	TaskType string
+}
+
+// Row is one aggregated line of a usage report
+type Row struct {
+	Day              string  `json:"day"`
+	Provider         string  `json:"provider"`
+	TaskType         string  `json:"task_type"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Spend is a provider's consumption in the calendar day and month
+type Spend struct {
+	DayTokens   int     `json:"day_tokens"`
+	DayUSD      float64 `json:"day_usd"`
+	MonthTokens int     `json:"month_tokens"`
+	MonthUSD    float64 `json:"month_usd"`
+}
+
+// Tracker persists LLM token usage and prices it against a per-model table.
+type Tracker struct {
+	db     *sql.DB
+	mu     sync.RWMutex
+	prices map[string]Price
+}
+
+// NewTracker creates a usage tracker backed by SQLite. Prices are keyed by
+// model name, or by "provider/model" to price the same model differently
+// per provider; models without an entry cost nothing.
+func NewTracker(dbPath string, prices map[string]Price) (*Tracker, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS llm_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id TEXT,
+			task_type TEXT NOT NULL DEFAULT '',
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL DEFAULT '',
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			total_tokens INTEGER NOT NULL DEFAULT 0,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			day TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_usage_day ON llm_usage(day);
+		CREATE INDEX IF NOT EXISTS idx_llm_usage_task ON llm_usage(task_id);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+
+	t := &Tracker{db: db}
+	t.SetPrices(prices)
+	return t, nil
+}
+
+// SetPrices replaces the price table. Costs already recorded are kept.
+func (t *Tracker) SetPrices(prices map[string]Price) {
+	copied := make(map[string]Price, len(prices))
+	for k, v := range prices {
+		copied[k] = v
+	}
+	t.mu.Lock()
+	t.prices = copied
+	t.mu.Unlock()
+}
+
+// Cost returns the USD cost of a call, preferring a "provider/model" price
+// over a plain model price
+func (t *Tracker) Cost(provider, model string, promptTokens, completionTokens int) float64 {
+	t.mu.RLock()
+	price, ok := t.prices[provider+"/"+model]
+	if !ok {
+		price = t.prices[model]
+	}
+	t.mu.RUnlock()
+
+	return (float64(promptTokens)*price.InputPerMTok + float64(completionTokens)*price.OutputPerMTok) / 1e6
+}
+
+// Record stores a usage record, filling in the total, cost and timestamp
+// when they are not set
+func (t *Tracker) Record(r Record) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	if r.TotalTokens == 0 {
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+	}
+	if r.CostUSD == 0 {
+		r.CostUSD = t.Cost(r.Provider, r.Model, r.PromptTokens, r.CompletionTokens)
+	}
+
+	var taskID sql.NullString
+	if r.TaskID != "" {
+		taskID = sql.NullString{String: r.TaskID, Valid: true}
+	}
+
+	_, err := t.db.Exec(`
+		INSERT INTO llm_usage (task_id, task_type, provider, model, prompt_tokens, completion_tokens, total_tokens, cost_usd, day, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, taskID, r.TaskType, r.Provider, r.Model, r.PromptTokens, r.CompletionTokens, r.TotalTokens, r.CostUSD,
+		r.CreatedAt.Local().Format(dayFormat), r.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert usage: %w", err)
+	}
+	return nil
+}
+
+// Report aggregates usage by day, provider and task type, newest day first
+func (t *Tracker) Report(q Query) ([]Row, error) {
+	var where []string
+	var args []any
+	if !q.Since.IsZero() {
+		where = append(where, "day >= ?")
+		args = append(args, q.Since.Local().Format(dayFormat))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "day <= ?")
+		args = append(args, q.Until.Local().Format(dayFormat))
+	}
+	if q.Provider != "" {
+		where = append(where, "provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.TaskType != "" {
+		where = append(where, "task_type = ?")
+		args = append(args, q.TaskType)
+	}
+
+	query := `
+		SELECT day, provider, task_type, COUNT(*),
+			SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(cost_usd)
+		FROM llm_usage`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += `
+		GROUP BY day, provider, task_type
+		ORDER BY day DESC, provider, task_type`
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var report []Row
+	for rows.Next() {
+		var row Row
+		if err := rows.Scan(&row.Day, &row.Provider, &row.TaskType, &row.Calls,
+			&row.PromptTokens, &row.CompletionTokens, &row.TotalTokens, &row.CostUSD); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// Spend returns what provider has used on the day and in the month
+// containing now, in local time
+func (t *Tracker) Spend(provider string, now time.Time) (Spend, error) {
+	now = now.Local()
+	day := now.Format(dayFormat)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).Format(dayFormat)
+
+	var s Spend
+	err := t.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN day = ? THEN total_tokens END), 0),
+			COALESCE(SUM(CASE WHEN day = ? THEN cost_usd END), 0),
+			COALESCE(SUM(total_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)
+		FROM llm_usage
+		WHERE provider = ? AND day >= ? AND day <= ?
+	`, day, day, provider, monthStart, day).Scan(&s.DayTokens, &s.DayUSD, &s.MonthTokens, &s.MonthUSD)
+	if err != nil {
+		return Spend{}, fmt.Errorf("query spend: %w", err)
+	}
+	return s, nil
+}
+
+// ListByTask returns every usage record for a task in call order
+func (t *Tracker) ListByTask(taskID string) ([]Record, error) {
+	rows, err := t.db.Query(`
+		SELECT task_id, task_type, provider, model, prompt_tokens, completion_tokens, total_tokens, cost_usd, created_at
+		FROM llm_usage WHERE task_id = ? ORDER BY id
+	`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.TaskID, &r.TaskType, &r.Provider, &r.Model, &r.PromptTokens,
+			&r.CompletionTokens, &r.TotalTokens, &r.CostUSD, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Close closes the underlying database.
+func (t *Tracker) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestTracker(t *testing.T, prices map[string]Price) *Tracker {
+	t.Helper()
+	tr, err := NewTracker(filepath.Join(t.TempDir(), "test.db"), prices)
+	if err != nil {
+		t.Fatalf("NewTracker: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestTrackerCost(t *testing.T) {
+	tr := newTestTracker(t, map[string]Price{
+		"gpt-4o-mini":       {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+		"openrouter/gpt-4o": {InputPerMTok: 3, OutputPerMTok: 12},
+		"gpt-4o":            {InputPerMTok: 2.5, OutputPerMTok: 10},
+	})
+
+	if got := tr.Cost("openai", "gpt-4o-mini", 1_000_000, 1_000_000); math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("expected 0.75, got %f", got)
+	}
+	if got := tr.Cost("openrouter", "gpt-4o", 1_000_000, 0); got != 3 {
+		t.Errorf("expected provider-specific price 3, got %f", got)
+	}
+	if got := tr.Cost("ollama", "llama3.2", 1_000_000, 1_000_000); got != 0 {
+		t.Errorf("expected unpriced model to be free, got %f", got)
+	}
+}
+
+func TestTrackerReportGroupsByDayProviderTaskType(t *testing.T) {
+	tr := newTestTracker(t, map[string]Price{"gpt-4o-mini": {InputPerMTok: 1, OutputPerMTok: 2}})
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	records := []Record{
+		{TaskID: "t1", TaskType: "git.commit", Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 1000, CompletionTokens: 500, CreatedAt: today},
+		{TaskID: "t2", TaskType: "git.commit", Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 1000, CompletionTokens: 500, CreatedAt: today},
+		{TaskID: "t3", TaskType: "file.classify", Provider: "ollama", Model: "llama3.2", PromptTokens: 200, CompletionTokens: 5, CreatedAt: today},
+		{TaskID: "t4", TaskType: "git.commit", Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 10, CompletionTokens: 10, CreatedAt: yesterday},
+	}
+	for _, r := range records {
+		if err := tr.Record(r); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	rows, err := tr.Report(Query{Since: today})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows for today, got %d: %+v", len(rows), rows)
+	}
+
+	// Rows are ordered by provider within a day
+	if rows[0].Provider != "ollama" || rows[0].Calls != 1 || rows[0].CostUSD != 0 {
+		t.Errorf("unexpected ollama row: %+v", rows[0])
+	}
+	commit := rows[1]
+	if commit.TaskType != "git.commit" || commit.Calls != 2 || commit.TotalTokens != 3000 {
+		t.Errorf("unexpected commit row: %+v", commit)
+	}
+	if math.Abs(commit.CostUSD-0.004) > 1e-9 {
+		t.Errorf("expected cost 0.004, got %f", commit.CostUSD)
+	}
+
+	all, err := tr.Report(Query{TaskType: "git.commit"})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(all) != 2 || all[0].Day != today.Format(dayFormat) {
+		t.Errorf("expected newest day first across 2 days, got %+v", all)
+	}
+}
+
+func TestTrackerListByTask(t *testing.T) {
+	tr := newTestTracker(t, nil)
+
+	tr.Record(Record{TaskID: "t1", Provider: "ollama", PromptTokens: 1})
+	tr.Record(Record{TaskID: "t1", Provider: "openai", PromptTokens: 2})
+	tr.Record(Record{TaskID: "t2", Provider: "ollama", PromptTokens: 3})
+
+	records, err := tr.ListByTask("t1")
+	if err != nil {
+		t.Fatalf("ListByTask: %v", err)
+	}
+	if len(records) != 2 || records[0].Provider != "ollama" || records[1].Provider != "openai" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestTrackerSpend(t *testing.T) {
+	tr := newTestTracker(t, map[string]Price{"gpt-4o": {InputPerMTok: 1000, OutputPerMTok: 0}})
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+	tr.Record(Record{Provider: "openai", Model: "gpt-4o", PromptTokens: 100, CreatedAt: now})
+	tr.Record(Record{Provider: "openai", Model: "gpt-4o", PromptTokens: 50, CreatedAt: now.AddDate(0, 0, -3)})
+	tr.Record(Record{Provider: "openai", Model: "gpt-4o", PromptTokens: 70, CreatedAt: now.AddDate(0, -1, 0)})
+	tr.Record(Record{Provider: "ollama", PromptTokens: 500, CreatedAt: now})
+
+	s, err := tr.Spend("openai", now)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if s.DayTokens != 100 || s.MonthTokens != 150 {
+		t.Errorf("unexpected token spend: %+v", s)
+	}
+	if math.Abs(s.DayUSD-0.1) > 1e-9 || math.Abs(s.MonthUSD-0.15) > 1e-9 {
+		t.Errorf("unexpected usd spend: %+v", s)
+	}
+}
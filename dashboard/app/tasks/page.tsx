@@ -80,7 +80,7 @@ export default function TasksPage() {
 
   function isFileOperation(type: string) {
     return type === 'file.classify' || type === 'file.rename' ||
-      type === 'pipeline.auto_file' || type === 'pipeline.screenshot';
+      type === 'auto_file.finish' || type === 'pipeline.screenshot';
   }
 
   function formatJSON(str: string | undefined) {